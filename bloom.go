@@ -0,0 +1,54 @@
+package chankit
+
+import (
+	"hash/maphash"
+	"math"
+)
+
+// bloomFilter is a probabilistic set: contains may report false positives,
+// but never false negatives.
+type bloomFilter[K comparable] struct {
+	bits  []uint64
+	m     uint64 // number of bits
+	k     uint64 // number of hash functions
+	seed1 maphash.Seed
+	seed2 maphash.Seed
+}
+
+// newBloomFilter sizes a filter for n keys with the given false positive rate.
+func newBloomFilter[K comparable](n int, fpRate float64) *bloomFilter[K] {
+	n = max(n, 1)
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = 0.01
+	}
+
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	k := uint64(max(math.Round(float64(m)/float64(n)*math.Ln2), 1))
+
+	return &bloomFilter[K]{
+		bits:  make([]uint64, (m+63)/64),
+		m:     m,
+		k:     k,
+		seed1: maphash.MakeSeed(),
+		seed2: maphash.MakeSeed(),
+	}
+}
+
+// add inserts key and reports whether it was possibly present before.
+func (b *bloomFilter[K]) add(key K) bool {
+	// double hashing: h_i = h1 + i*h2
+	h1 := maphash.Comparable(b.seed1, key)
+	h2 := maphash.Comparable(b.seed2, key) | 1
+
+	present := true
+	for i := range b.k {
+		bit := (h1 + i*h2) % b.m
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if b.bits[word]&mask == 0 {
+			present = false
+			b.bits[word] |= mask
+		}
+	}
+	return present
+}
@@ -0,0 +1,167 @@
+package chankit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+type breakerOpt struct {
+	failureRate float64
+	window      int
+	coolDown    time.Duration
+}
+
+// circuitBreaker tracks the outcome of the last calls of a stage function.
+//
+// While closed, calls run normally; once at least `window` calls were made
+// and the failure rate over the last `window` of them reaches `failureRate`,
+// it opens. While open, calls are rejected with ErrCircuitOpen. After
+// `coolDown`, it turns half-open and lets a single trial call through: a
+// success closes it, a failure opens it again.
+type circuitBreaker struct {
+	opt   breakerOpt
+	clock Clock
+
+	mu       sync.Mutex
+	state    breakerState
+	openedAt time.Time
+	trial    bool   // a half-open trial call is in flight
+	outcomes []bool // ring of the last calls, true for failures
+	next     int
+	failures int
+}
+
+func newCircuitBreaker(opt breakerOpt, clock Clock) *circuitBreaker {
+	return &circuitBreaker{
+		opt:      opt,
+		clock:    clock,
+		outcomes: make([]bool, 0, opt.window),
+	}
+}
+
+// allow reports whether a call may run now.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.opt.coolDown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.trial = true
+		return true
+	case breakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+// record accounts for the outcome of a call admitted by allow.
+func (b *circuitBreaker) record(failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerHalfOpen:
+		b.trial = false
+		if failed {
+			b.openLocked()
+			return
+		}
+		b.state = breakerClosed
+		b.outcomes, b.next, b.failures = b.outcomes[:0], 0, 0
+	case breakerClosed:
+		if len(b.outcomes) < b.opt.window {
+			b.outcomes = append(b.outcomes, failed)
+		} else {
+			if b.outcomes[b.next] {
+				b.failures--
+			}
+			b.outcomes[b.next] = failed
+			b.next = (b.next + 1) % b.opt.window
+		}
+		if failed {
+			b.failures++
+		}
+		if len(b.outcomes) == b.opt.window &&
+			float64(b.failures) >= b.opt.failureRate*float64(b.opt.window) {
+			b.openLocked()
+		}
+	}
+}
+
+// cancel gives back the half-open trial slot of a call that did not
+// complete because its context was canceled.
+func (b *circuitBreaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.trial = false
+	}
+}
+
+func (b *circuitBreaker) openLocked() {
+	b.state = breakerOpen
+	b.openedAt = b.clock.Now()
+}
+
+// withCircuitBreaker short-circuits calls of fn with ErrCircuitOpen while b
+// is open.
+func withCircuitBreaker[A, B any](
+	fn func(context.Context, A) (B, error),
+	b *circuitBreaker,
+	obs *stageObserver,
+) func(context.Context, A) (B, error) {
+	return func(ctx context.Context, a A) (B, error) {
+		if !b.allow() {
+			// fn is not called, so the rejection is reported here
+			obs.failed(ErrCircuitOpen)
+			var zero B
+			return zero, ErrCircuitOpen
+		}
+
+		v, err := fn(ctx, a)
+		if err != nil && ctx.Err() != nil {
+			b.cancel()
+		} else {
+			b.record(err != nil)
+		}
+		return v, err
+	}
+}
+
+// errSkip tells Map implementations to drop an element without failing.
+var errSkip = errors.New("skip element")
+
+// withDeadLetter hands elements whose call of fn failed to onErr and skips
+// them. Errors caused by the cancellation of the stage still fail it.
+func withDeadLetter[A, B any](
+	fn func(context.Context, A) (B, error),
+	onErr func(A, error),
+) func(context.Context, A) (B, error) {
+	return func(ctx context.Context, a A) (B, error) {
+		v, err := fn(ctx, a)
+		if err != nil && ctx.Err() == nil {
+			onErr(a, err)
+			return v, errSkip
+		}
+		return v, err
+	}
+}
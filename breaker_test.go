@@ -0,0 +1,207 @@
+package chankit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	clock := newFakeClock()
+	b := newCircuitBreaker(breakerOpt{failureRate: 0.5, window: 4, coolDown: time.Second}, clock)
+
+	for _, failed := range []bool{false, true, false} {
+		if !b.allow() {
+			t.Fatal("closed breaker must allow calls")
+		}
+		b.record(failed)
+	}
+	if !b.allow() {
+		t.Fatal("breaker must not open before the window is full")
+	}
+	b.record(true)
+
+	if b.allow() {
+		t.Fatal("breaker must open at the failure rate")
+	}
+
+	clock.Advance(time.Second)
+	if !b.allow() {
+		t.Fatal("breaker must let a trial call through after the cool-down")
+	}
+	if b.allow() {
+		t.Fatal("half-open breaker must allow a single trial call")
+	}
+	b.record(true)
+	if b.allow() {
+		t.Fatal("failed trial must open the breaker again")
+	}
+
+	clock.Advance(time.Second)
+	if !b.allow() {
+		t.Fatal("breaker must let a trial call through after the cool-down")
+	}
+	b.record(false)
+	for range 4 {
+		if !b.allow() {
+			t.Fatal("successful trial must close the breaker")
+		}
+		b.record(false)
+	}
+}
+
+func TestMapCircuitBreaker(t *testing.T) {
+	errDown := errors.New("dependency down")
+	fn := func(_ context.Context, x int) (int, error) {
+		if x >= 3 {
+			return 0, errDown
+		}
+		return x, nil
+	}
+
+	t.Run("dead letter", func(t *testing.T) {
+		t.Parallel()
+
+		for _, par := range []int{0, 4} {
+			var mu sync.Mutex
+			dead := make(map[error]int)
+			obs := newCountingObserver()
+
+			p, ctx := NewPipeline(t.Context(), WithPipelineObserver(obs))
+			got := chan2slice(MapErrCtx(
+				ctx,
+				p,
+				slice2chan(genInts(20)),
+				fn,
+				WithParallel(par),
+				WithCircuitBreaker(1, 2, time.Hour),
+				WithName("map"),
+				WithDeadLetter(func(_ int, err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					dead[err]++
+				}),
+			))
+
+			assertNoPipeError(t, p)
+			// workers race, so the breaker may open before every healthy
+			// element was tried
+			for i, x := range got {
+				if x >= 3 || (i > 0 && x <= got[i-1]) {
+					t.Fatalf("unexpected output with parallelism %d: %v", par, got)
+				}
+			}
+			if dead[errDown] < 2 || dead[ErrCircuitOpen] == 0 ||
+				len(got)+dead[errDown]+dead[ErrCircuitOpen] != 20 {
+				t.Fatalf("unexpected dead letters with parallelism %d: %v", par, dead)
+			}
+			// rejected calls are reported as errors, but not as calls
+			c := obs.snapshot()["map"]
+			if c.errors != dead[errDown]+dead[ErrCircuitOpen] || c.calls != len(got)+dead[errDown] {
+				t.Fatalf("unexpected observed counts with parallelism %d: %+v", par, c)
+			}
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		t.Parallel()
+
+		p, ctx := NewPipeline(t.Context())
+		for range MapErrCtx(
+			ctx,
+			p,
+			slice2chan(genInts(20)),
+			fn,
+			WithCircuitBreaker(1, 1, time.Hour),
+		) {
+		}
+
+		if err := p.Wait(); !errors.Is(err, errDown) {
+			t.Fatalf("expected %v, got %v", errDown, err)
+		}
+	})
+}
+
+func TestMapDeadLetter(t *testing.T) {
+	errOdd := errors.New("odd")
+	fn := func(_ context.Context, x int) (int, error) {
+		if x%2 == 1 {
+			return 0, errOdd
+		}
+		return x, nil
+	}
+
+	tests := []struct {
+		name    string
+		ordered bool
+		popts   []PipelineOption
+		opts    []Option
+	}{
+		{"sequential", true, nil, nil},
+		{"unordered", false, nil, []Option{WithParallel(8), WithUnordered()}},
+		{"ordered", true, nil, []Option{WithParallel(8)}},
+		{
+			"ordered memory budget",
+			true,
+			[]PipelineOption{WithMemoryBudget(4)},
+			[]Option{WithParallel(8), WithSizeFunc(func(int) int { return 1 })},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			var dead []int
+			opts := append(tc.opts, WithDeadLetter(func(x int, err error) {
+				if !errors.Is(err, errOdd) {
+					t.Errorf("unexpected error %v", err)
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				dead = append(dead, x)
+			}))
+
+			items := genInts(100)
+			p, ctx := NewPipeline(t.Context(), tc.popts...)
+			got := chan2slice(MapErrCtx(ctx, p, slice2chan(items), fn, opts...))
+
+			assertNoPipeError(t, p)
+			want := filterInts(items, func(x int) bool { return x%2 == 0 })
+			if tc.ordered {
+				assertSlicesEqual(t, want, got)
+			} else {
+				assertSameElementsAs(t, want, got)
+			}
+			if len(dead) != 50 {
+				t.Fatalf("expected 50 dead letters, got %d", len(dead))
+			}
+		})
+	}
+
+	t.Run("mismatched func", func(t *testing.T) {
+		t.Parallel()
+
+		p, ctx := NewPipeline(t.Context(), WithMemoryBudget(4))
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic expected")
+			}
+			if n := len(p.registered()); n != 0 {
+				t.Fatalf("expected no stage, got %d", n)
+			}
+			assertNoPipeError(t, p)
+		}()
+
+		_ = MapErrCtx(ctx, p, make(chan int), fn,
+			WithBuffer(4),
+			WithSizeFunc(func(int) int { return 1 }),
+			WithDeadLetter(func(string, error) {}),
+		)
+	})
+}
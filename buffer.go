@@ -0,0 +1,188 @@
+package chankit
+
+import "context"
+
+// OverflowPolicy decides what Buffer does with a new element when full.
+type OverflowPolicy int
+
+const (
+	OverflowBlock      OverflowPolicy = iota // stop reading input until there is room (default)
+	OverflowDropNewest                       // discard the new element
+	OverflowDropOldest                       // discard the oldest buffered element
+)
+
+func (o OverflowPolicy) String() string {
+	switch o {
+	case OverflowBlock:
+		return "OverflowBlock"
+	case OverflowDropNewest:
+		return "OverflowDropNewest"
+	case OverflowDropOldest:
+		return "OverflowDropOldest"
+	default:
+		return "UnknownOverflowPolicy"
+	}
+}
+
+// Buffer forwards elements from `in`, holding up to `n` of them while the
+// consumer is slower than the producer.
+//
+// When the buffer is full, `policy` decides whether to block the producer
+// or to discard elements. Discarded elements are counted with
+// WithDropCounter. Within a pipeline created with WithMemoryBudget, the held
+// elements are also accounted against the budget (see WithSizeFunc), and
+// the buffer counts as full while the budget is exhausted. A single element
+// is always admitted into an empty buffer, so that the stage progresses.
+// It closes the returned channel after input is fully consumed and the
+// buffer is flushed.
+// If ctx is canceled, it stops early and returns.
+func Buffer[A any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	n int,
+	policy OverflowPolicy,
+	opts ...Option,
+) <-chan A {
+	if n <= 0 {
+		panic("n must be > 0")
+	}
+	if policy < OverflowBlock || policy > OverflowDropOldest {
+		panic("Buffer: unknown overflow policy")
+	}
+
+	cfg := makeConfig(opts)
+	cfg.bufCap = n // the ring is the output buffer of the stage
+	out := make(chan A)
+	st, ctx := p.newStage(ctx, cfg, "buffer", out, in)
+	defer st.launched()
+
+	sizeFn := sizeFunc[A](cfg)
+	mem := p.mem
+	if sizeFn == nil {
+		mem = nil
+	}
+
+	type sized struct {
+		val  A
+		size int64
+	}
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		ring := make([]sized, n)
+		head, size := 0, 0
+
+		push := func(s sized) {
+			ring[(head+size)%n] = s
+			size++
+		}
+		pop := func() {
+			if mem != nil {
+				mem.release(ring[head].size)
+			}
+			ring[head] = sized{}
+			head = (head + 1) % n
+			size--
+		}
+		defer func() {
+			for size > 0 {
+				pop()
+			}
+		}()
+		// fits takes the bytes of s from the budget, if any
+		fits := func(s sized) (bool, <-chan struct{}) {
+			if mem == nil {
+				return true, nil
+			}
+			return mem.tryAcquire(s.size, size == 0)
+		}
+		dropped := func() {
+			if cfg.dropCnt != nil {
+				cfg.dropCnt.Add(1)
+			}
+		}
+
+		// with OverflowBlock, an element waiting for budget
+		var pending sized
+		var hasPending bool
+		var budgetC <-chan struct{}
+
+		for {
+			if hasPending {
+				if ok, changed := fits(pending); ok {
+					push(pending)
+					pending, hasPending, budgetC = sized{}, false, nil
+				} else {
+					budgetC = changed
+				}
+			}
+
+			if in == nil && size == 0 && !hasPending {
+				return nil
+			}
+
+			inC := in
+			if hasPending || (size == n && policy == OverflowBlock) {
+				inC = nil
+			}
+
+			var outC chan<- A
+			var next A
+			if size > 0 {
+				outC = out
+				next = ring[head].val
+			}
+
+			// blocked sending only once it cannot accept input
+			if inC == nil && outC != nil {
+				pr.set(StageSending)
+			} else {
+				pr.set(StageReading)
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-budgetC:
+			case a, ok := <-inC:
+				if !ok {
+					in = nil
+					continue
+				}
+				st.receive()
+
+				s := sized{val: a}
+				if mem != nil {
+					s.size = int64(sizeFn(a))
+				}
+				if policy == OverflowBlock {
+					pending, hasPending = s, true
+					continue
+				}
+
+				// make room by dropping the new element or the oldest ones
+				for {
+					if size < n {
+						if ok, _ := fits(s); ok {
+							push(s)
+							break
+						}
+					}
+					dropped()
+					if policy == OverflowDropNewest {
+						break
+					}
+					pop()
+				}
+			case outC <- next:
+				st.emit(size - 1)
+				pop()
+			}
+		}
+	})
+
+	return out
+}
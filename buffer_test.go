@@ -0,0 +1,89 @@
+package chankit
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestBuffer(t *testing.T) {
+	// either 3 slots, or 100 slots and a memory budget of 3 elements
+	tests := []struct {
+		name        string
+		policy      OverflowPolicy
+		budget      bool
+		want        []int
+		wantDropped int64
+	}{
+		{"block", OverflowBlock, false, []int{1, 2, 3, 4, 5}, 0},
+		{"drop newest", OverflowDropNewest, false, []int{1, 2, 3}, 2},
+		{"drop oldest", OverflowDropOldest, false, []int{3, 4, 5}, 2},
+		{"block budget", OverflowBlock, true, []int{1, 2, 3, 4, 5}, 0},
+		{"drop newest budget", OverflowDropNewest, true, []int{1, 2, 3}, 2},
+		{"drop oldest budget", OverflowDropOldest, true, []int{3, 4, 5}, 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var dropped atomic.Int64
+			in := make(chan int)
+
+			n := 3
+			var popts []PipelineOption
+			opts := []Option{WithDropCounter(&dropped)}
+			if tc.budget {
+				n = 100
+				popts = append(popts, WithMemoryBudget(12))
+				opts = append(opts, WithSizeFunc(func(int) int { return 4 }))
+			}
+
+			p, ctx := NewPipeline(t.Context(), popts...)
+			out := Buffer(ctx, p, in, n, tc.policy, opts...)
+
+			sent := make(chan struct{})
+			go func() {
+				defer close(sent)
+				defer close(in)
+				for i := 1; i <= 5; i++ {
+					in <- i
+				}
+			}()
+			if tc.policy != OverflowBlock {
+				// the producer never blocks, so nobody reads until it is done
+				<-sent
+			}
+			got := chan2slice(out)
+
+			assertNoPipeError(t, p)
+			assertSlicesEqual(t, tc.want, got)
+			if n := dropped.Load(); n != tc.wantDropped {
+				t.Fatalf("expected %d dropped, got %d", tc.wantDropped, n)
+			}
+			if tc.budget {
+				if n := p.mem.inUse(); n != 0 {
+					t.Fatalf("expected budget to be released, %d bytes in use", n)
+				}
+			}
+		})
+	}
+}
+
+func FuzzBuffer_Block(f *testing.F) {
+	f.Add(100, 1)
+	f.Add(1000, 16)
+
+	f.Fuzz(func(t *testing.T, itemsN, n int) {
+		if itemsN < 0 || itemsN > 2_000 || n <= 0 || n > 1_000 {
+			t.Skip()
+		}
+
+		items := genInts(itemsN)
+
+		p, ctx := NewPipeline(t.Context())
+		got := chan2slice(Buffer(ctx, p, slice2chan(items), n, OverflowBlock))
+
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, items, got)
+	})
+}
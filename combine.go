@@ -0,0 +1,144 @@
+package chankit
+
+import "context"
+
+// CombineLatest emits `f` applied to the latest elements of `leftIn` and
+// `rightIn` whenever either side produces an element.
+//
+// Nothing is emitted until both sides have produced at least one element.
+// A finished side keeps contributing its last element. The HaltStrategy
+// (see WithHaltStrategy) decides when to stop; by default it waits for both
+// sides to finish.
+// If ctx is canceled, it stops early and returns.
+func CombineLatest[A, B, C any](
+	ctx context.Context,
+	p *Pipeline,
+	leftIn <-chan A,
+	rightIn <-chan B,
+	f func(A, B) C,
+	opts ...Option,
+) <-chan C {
+	if leftIn == nil || rightIn == nil {
+		panic("CombineLatest: input channels must not be nil")
+	}
+
+	cfg := makeConfig(opts)
+	out, ret := makeOut[C](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "combine-latest", ret, leftIn, rightIn)
+	defer st.launched()
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		var left A
+		var right B
+		var haveLeft, haveRight bool
+
+		emit := func() error {
+			if !haveLeft || !haveRight {
+				return nil
+			}
+			pr.set(StageSending)
+			defer pr.set(StageReading)
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case out <- f(left, right):
+				st.emit(len(out))
+				return nil
+			}
+		}
+
+		return mergeLoop(
+			ctx,
+			cfg.haltStrategy,
+			leftIn,
+			rightIn,
+			func(a A) error {
+				st.receive()
+				left, haveLeft = a, true
+				return emit()
+			},
+			func(b B) error {
+				st.receive()
+				right, haveRight = b, true
+				return emit()
+			},
+		)
+	})
+
+	return ret
+}
+
+// WithLatestFrom emits `f` applied to every element of `in` and the latest
+// element of `latest`.
+//
+// Elements of `in` arriving before `latest` produced anything are dropped.
+// Once `latest` finishes, its last element keeps being used. The HaltStrategy
+// (see WithHaltStrategy) decides when to stop; by default it stops when `in`
+// finishes (HaltLeft).
+// If ctx is canceled, it stops early and returns.
+func WithLatestFrom[A, B, C any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	latest <-chan B,
+	f func(A, B) C,
+	opts ...Option,
+) <-chan C {
+	if in == nil || latest == nil {
+		panic("WithLatestFrom: input channels must not be nil")
+	}
+
+	cfg := makeConfig(opts)
+	out, ret := makeOut[C](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "with-latest-from", ret, in, latest)
+	defer st.launched()
+
+	halt := HaltLeft
+	if cfg.haltSet {
+		halt = cfg.haltStrategy
+	}
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		var last B
+		var haveLast bool
+
+		return mergeLoop(
+			ctx,
+			halt,
+			in,
+			latest,
+			func(a A) error {
+				st.receive()
+				if !haveLast {
+					return nil
+				}
+				pr.set(StageSending)
+				defer pr.set(StageReading)
+
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case out <- f(a, last):
+					st.emit(len(out))
+					return nil
+				}
+			},
+			func(b B) error {
+				st.receive()
+				last, haveLast = b, true
+				return nil
+			},
+		)
+	})
+
+	return ret
+}
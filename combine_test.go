@@ -0,0 +1,90 @@
+package chankit
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCombineLatest(t *testing.T) {
+	t.Parallel()
+
+	left := make(chan int)
+	right := make(chan int)
+
+	p, ctx := NewPipeline(t.Context())
+	out := CombineLatest(ctx, p, left, right, func(a, b int) int { return a*10 + b })
+
+	left <- 1
+	left <- 2
+	right <- 1
+	if v := <-out; v != 21 {
+		t.Fatalf("expected 21, got %d", v)
+	}
+	right <- 2
+	if v := <-out; v != 22 {
+		t.Fatalf("expected 22, got %d", v)
+	}
+	close(right)
+	left <- 3
+	if v := <-out; v != 32 {
+		t.Fatalf("expected 32, got %d", v)
+	}
+	close(left)
+
+	if rest := chan2slice(out); len(rest) != 0 {
+		t.Fatalf("expected no more values, got %v", rest)
+	}
+	assertNoPipeError(t, p)
+}
+
+func TestWithLatestFrom(t *testing.T) {
+	t.Run("uses latest value", func(t *testing.T) {
+		t.Parallel()
+
+		data := make(chan int)
+		settings := make(chan int)
+
+		p, ctx := NewPipeline(t.Context())
+		out := WithLatestFrom(ctx, p, data, settings, func(v, mul int) int { return v * mul })
+
+		data <- 1 // dropped, no settings yet
+		settings <- 10
+		data <- 2
+		if v := <-out; v != 20 {
+			t.Fatalf("expected 20, got %d", v)
+		}
+		settings <- 100
+		data <- 3
+		if v := <-out; v != 300 {
+			t.Fatalf("expected 300, got %d", v)
+		}
+		close(data) // settings never closes
+
+		if rest := chan2slice(out); len(rest) != 0 {
+			t.Fatalf("expected no more values, got %v", rest)
+		}
+		assertNoPipeError(t, p)
+	})
+
+	t.Run("halt either", func(t *testing.T) {
+		t.Parallel()
+
+		p, ctx := NewPipeline(t.Context())
+		out := WithLatestFrom(
+			ctx,
+			p,
+			make(chan int),
+			slice2chan([]int{1}),
+			func(v, mul int) int { return v * mul },
+			WithHaltStrategy(HaltEither),
+		)
+
+		if got := chan2slice(out); len(got) != 0 {
+			t.Fatalf("expected no values, got %v", got)
+		}
+		if err := p.Wait(); err != nil && !errors.Is(err, context.Canceled) {
+			t.Fatalf("pipeline error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package chankit
+
+import "context"
+
+// Concat forwards all elements of each input in turn: the next input is read
+// only after the previous one is closed.
+//
+// Inputs that are not being read yet are not drained, so their senders block
+// until their turn comes.
+// It closes the returned channel after all inputs are fully consumed.
+// If ctx is canceled, it stops early and returns.
+//
+// Concat takes no options; use ConcatLazy with factories returning the
+// inputs to set them.
+func Concat[A any](
+	ctx context.Context,
+	p *Pipeline,
+	ins ...<-chan A,
+) <-chan A {
+	factories := make([]func() <-chan A, len(ins))
+	stageIns := make([]any, len(ins))
+	for i, in := range ins {
+		factories[i] = func() <-chan A { return in }
+		stageIns[i] = in
+	}
+	return concatImpl(ctx, p, factories, stageIns)
+}
+
+// ConcatLazy is like Concat, but creates each input by calling its factory
+// only once the previous input is closed, so later streams are not started
+// before they are needed.
+//
+// A factory returning nil is treated as an empty input.
+func ConcatLazy[A any](
+	ctx context.Context,
+	p *Pipeline,
+	factories []func() <-chan A,
+	opts ...Option,
+) <-chan A {
+	return concatImpl(ctx, p, factories, nil, opts...)
+}
+
+// concatImpl implements Concat and ConcatLazy. ins are the inputs known
+// upfront, registered as the inputs of the stage.
+func concatImpl[A any](
+	ctx context.Context,
+	p *Pipeline,
+	factories []func() <-chan A,
+	ins []any,
+	opts ...Option,
+) <-chan A {
+	cfg := makeConfig(opts)
+	out, ret := makeOut[A](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "concat", ret, ins...)
+	defer st.launched()
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		for _, factory := range factories {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			pr.set(StageRunning)
+			in := factory()
+			if in == nil {
+				continue
+			}
+
+		loop:
+			for {
+				pr.set(StageReading)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case a, ok := <-in:
+					if !ok {
+						break loop
+					}
+					st.receive()
+
+					pr.set(StageSending)
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case out <- a:
+						st.emit(len(out))
+					}
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return ret
+}
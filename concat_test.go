@@ -0,0 +1,93 @@
+package chankit
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestConcat(t *testing.T) {
+	tests := []struct {
+		name string
+		ins  [][]int
+		want []int
+	}{
+		{"no inputs", nil, nil},
+		{"single", [][]int{{1, 2}}, []int{1, 2}},
+		{"ordered", [][]int{{1, 2}, nil, {3}, {4, 5}}, []int{1, 2, 3, 4, 5}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ins := make([]<-chan int, len(tc.ins))
+			for i, in := range tc.ins {
+				ins[i] = slice2chan(in)
+			}
+
+			p, ctx := NewPipeline(t.Context())
+			got := chan2slice(Concat(ctx, p, ins...))
+
+			assertNoPipeError(t, p)
+			assertSlicesEqual(t, tc.want, got)
+		})
+	}
+}
+
+func TestConcatLazy(t *testing.T) {
+	t.Run("starts inputs in turn", func(t *testing.T) {
+		t.Parallel()
+
+		first := make(chan int)
+		var started atomic.Int32
+		factories := []func() <-chan int{
+			func() <-chan int { started.Add(1); return first },
+			func() <-chan int { return nil },
+			func() <-chan int { started.Add(1); return slice2chan([]int{3}) },
+		}
+
+		p, ctx := NewPipeline(t.Context())
+		out := ConcatLazy(ctx, p, factories, WithBuffer(1))
+
+		first <- 1
+		first <- 2
+		if v := <-out; v != 1 {
+			t.Fatalf("expected 1, got %d", v)
+		}
+		if n := started.Load(); n != 1 {
+			t.Fatalf("expected only the first input started before it is closed, got %d", n)
+		}
+
+		close(first)
+		rest := chan2slice(out)
+
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, []int{2, 3}, rest)
+		if n := started.Load(); n != 2 {
+			t.Fatalf("expected 2 started inputs, got %d", n)
+		}
+	})
+
+	t.Run("does not start after cancel", func(t *testing.T) {
+		t.Parallel()
+
+		p, ctx := NewPipeline(t.Context())
+		stageCtx, cancel := context.WithCancel(ctx)
+
+		started := false
+		out := ConcatLazy(stageCtx, p, []func() <-chan int{
+			func() <-chan int { cancel(); return slice2chan([]int{1}) },
+			func() <-chan int { started = true; return nil },
+		})
+		_ = chan2slice(out)
+
+		if err := p.Wait(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+		if started {
+			t.Fatal("second input must not be started")
+		}
+	})
+}
@@ -0,0 +1,163 @@
+package chankit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// StageState is what a stage is doing, see Pipeline.Diagnose.
+type StageState int
+
+const (
+	// StageStopped means that all the goroutines of the stage returned.
+	StageStopped StageState = iota
+	// StageReading means that the stage waits for input.
+	StageReading
+	// StageRunning means that the stage runs user code, or hands an element
+	// over between its own goroutines.
+	StageRunning
+	// StageSending means that the stage waits for downstream to accept an
+	// element.
+	StageSending
+)
+
+func (s StageState) String() string {
+	switch s {
+	case StageStopped:
+		return "stopped"
+	case StageReading:
+		return "reading"
+	case StageRunning:
+		return "running"
+	case StageSending:
+		return "sending"
+	default:
+		return fmt.Sprintf("StageState(%d)", int(s))
+	}
+}
+
+// StageDiagnosis is the state of a stage, see Pipeline.Diagnose.
+type StageDiagnosis struct {
+	StageInfo
+	// State is the state of the stage. Parallel stages report the most
+	// downstream state of their goroutines: sending, then running, then
+	// reading.
+	State StageState
+	// For is how long the goroutine that has been in State the longest has
+	// been in it, measured on the pipeline clock (see WithPipelineClock).
+	For time.Duration
+	// Goroutines is the number of goroutines of the stage still running.
+	Goroutines int
+}
+
+// Diagnose reports what the stages registered in the pipeline (see
+// Pipeline.Graph) are doing, e.g. to find the stage a stuck pipeline is
+// blocked on: the last stage blocked sending is usually waiting for a slow
+// or stuck consumer. It returns nil unless the pipeline was created with
+// WithDiagnostics or WithWatchdog.
+func (p *Pipeline) Diagnose() []StageDiagnosis {
+	if !p.diagnostics {
+		return nil
+	}
+	stages := p.registered()
+	diag := make([]StageDiagnosis, 0, len(stages))
+	for _, st := range stages {
+		diag = append(diag, st.diagnose())
+	}
+	return diag
+}
+
+func (s *stage) diagnose() StageDiagnosis {
+	d := StageDiagnosis{StageInfo: s.info}
+	now := s.p.clock.Now().UnixNano()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d.Goroutines = len(s.probes)
+	for pr := range s.probes {
+		state := StageState(pr.state.Load())
+		since := time.Duration(now - pr.since.Load())
+		switch {
+		case state > d.State:
+			d.State, d.For = state, since
+		case state == d.State:
+			d.For = max(d.For, since)
+		}
+	}
+	return d
+}
+
+// WithDiagnostics makes the stages of the pipeline track what their
+// goroutines are doing, see Pipeline.Diagnose. It costs a clock reading per
+// state change, so it is off by default.
+func WithDiagnostics() PipelineOption {
+	return func(p *Pipeline) {
+		p.diagnostics = true
+	}
+}
+
+// WatchdogAction is what the watchdog of a pipeline does about a stalled
+// stage, see WithWatchdog.
+type WatchdogAction int
+
+const (
+	// WatchdogLog logs stalled stages as warnings (see WithLogger).
+	WatchdogLog WatchdogAction = iota
+	// WatchdogFail fails the pipeline with ErrStageStalled.
+	WatchdogFail
+)
+
+// WithWatchdog watches the stages of the pipeline and acts on those blocked
+// sending downstream for at least threshold, see Pipeline.Diagnose. It checks
+// them every threshold/4 of the pipeline clock (see WithPipelineClock) and
+// stops once the pipeline context is done. It implies WithDiagnostics.
+func WithWatchdog(threshold time.Duration, action WatchdogAction) PipelineOption {
+	if threshold <= 0 {
+		panic("WithWatchdog: threshold must be > 0")
+	}
+	return func(p *Pipeline) {
+		p.diagnostics = true
+		p.watchdog = func(ctx context.Context) { p.watch(ctx, threshold, action) }
+	}
+}
+
+func (p *Pipeline) watch(ctx context.Context, threshold time.Duration, action WatchdogAction) {
+	ticker := p.clock.NewTicker(max(threshold/4, time.Millisecond))
+	defer ticker.Stop()
+
+	// keyed by stage, as names need not be unique
+	warned := make(map[*stage]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		for _, st := range p.registered() {
+			d := st.diagnose()
+			if d.State != StageSending || d.For < threshold {
+				delete(warned, st)
+				continue
+			}
+
+			if action == WatchdogFail {
+				err := fmt.Errorf("%w: %s blocked sending for %v", ErrStageStalled, d.Name, d.For)
+				p.fail(nil, err)
+				return
+			}
+			if p.log != nil && !warned[st] {
+				warned[st] = true
+				p.log.Warn("stage stalled",
+					slog.String("pipeline", d.Pipeline),
+					slog.String("stage", d.Name),
+					slog.String("kind", d.Kind),
+					slog.Duration("blocked", d.For),
+				)
+			}
+		}
+	}
+}
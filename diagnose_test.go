@@ -0,0 +1,193 @@
+package chankit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitDiagnosis polls p until stage name reaches state.
+func waitDiagnosis(t *testing.T, p *Pipeline, name string, state StageState) StageDiagnosis {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, d := range p.Diagnose() {
+			if d.Name == name && d.State == state {
+				return d
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("stage %s did not reach state %v: %+v", name, state, p.Diagnose())
+	return StageDiagnosis{}
+}
+
+func TestDiagnose(t *testing.T) {
+	t.Parallel()
+
+	clock := newFakeClock()
+	release := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	p, ctx := NewPipeline(ctx, WithDiagnostics(), WithPipelineClock(clock))
+
+	in := make(chan int)
+	slow := Map(ctx, p, in, func(x int) int {
+		if x == 1 {
+			<-release
+		}
+		return x
+	}, WithName("slow"))
+	_ = Filter(ctx, p, slow, func(int) bool { return true }, WithName("stuck"))
+
+	waitDiagnosis(t, p, "slow", StageReading)
+	in <- 0 // stuck is blocked sending it, nobody reads its output
+	in <- 1 // slow runs user code until released
+
+	waitDiagnosis(t, p, "stuck", StageSending)
+	waitDiagnosis(t, p, "slow", StageRunning)
+
+	clock.Advance(5 * time.Second)
+	d := waitDiagnosis(t, p, "stuck", StageSending)
+	if d.For != 5*time.Second || d.Goroutines != 1 {
+		t.Fatalf("unexpected diagnosis %+v", d)
+	}
+
+	close(release)
+	waitDiagnosis(t, p, "slow", StageSending)
+
+	cancel()
+	_ = p.Wait()
+	for _, d := range p.Diagnose() {
+		if d.State != StageStopped || d.Goroutines != 0 {
+			t.Fatalf("expected stopped stage, got %+v", d)
+		}
+	}
+}
+
+func TestDiagnoseDisabled(t *testing.T) {
+	t.Parallel()
+
+	p, ctx := NewPipeline(t.Context())
+	got := chan2slice(Map(ctx, p, slice2chan(genInts(3)), func(x int) int { return x }))
+
+	assertNoPipeError(t, p)
+	assertSlicesEqual(t, genInts(3), got)
+	if d := p.Diagnose(); d != nil {
+		t.Fatalf("expected no diagnosis without WithDiagnostics, got %+v", d)
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	const threshold = 10 * time.Millisecond
+
+	// stall starts a stage blocked sending, as nobody reads its output
+	stall := func(ctx context.Context, p *Pipeline) {
+		in := slice2chan(genInts(3))
+		_ = Map(ctx, p, in, func(x int) int { return x }, WithName("stalled"))
+	}
+	// advance moves clock well past threshold, letting the watchdog check
+	advance := func(clock *fakeClock) {
+		for range 20 {
+			clock.Advance(threshold)
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		t.Parallel()
+
+		clock := newFakeClock()
+		p, ctx := NewPipeline(
+			t.Context(),
+			WithPipelineClock(clock),
+			WithWatchdog(threshold, WatchdogFail),
+		)
+		stall(ctx, p)
+
+		done := make(chan error, 1)
+		go func() { done <- p.Wait() }()
+		if err, _ := recvAdvancing(t, clock, threshold, done); !errors.Is(err, ErrStageStalled) {
+			t.Fatalf("expected %v, got %v", ErrStageStalled, err)
+		}
+	})
+
+	t.Run("log", func(t *testing.T) {
+		t.Parallel()
+
+		clock := newFakeClock()
+		logger, logs := captureLogs(t)
+		ctx, cancel := context.WithCancel(t.Context())
+		p, ctx := NewPipeline(
+			ctx,
+			WithLogger(logger),
+			WithPipelineClock(clock),
+			WithWatchdog(threshold, WatchdogLog),
+		)
+		// stages with the same name are warned about separately
+		stall(ctx, p)
+		stall(ctx, p)
+
+		deadline := time.Now().Add(time.Second)
+		for sending := 0; sending < 2; {
+			if time.Now().After(deadline) {
+				t.Fatalf("stages did not stall: %+v", p.Diagnose())
+			}
+			time.Sleep(time.Millisecond)
+			sending = 0
+			for _, d := range p.Diagnose() {
+				if d.State == StageSending {
+					sending++
+				}
+			}
+		}
+		advance(clock)
+
+		cancel()
+		if err := p.Wait(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+
+		var warnings int
+		for _, r := range logs() {
+			if r.Msg == "stage stalled" && r.Stage == "stalled" {
+				warnings++
+			}
+		}
+		if warnings != 2 {
+			t.Fatalf("expected a single stall warning per stage, got %d", warnings)
+		}
+	})
+
+	t.Run("busy ordered map", func(t *testing.T) {
+		t.Parallel()
+
+		clock := newFakeClock()
+		p, ctx := NewPipeline(
+			t.Context(),
+			WithPipelineClock(clock),
+			WithWatchdog(threshold, WatchdogFail),
+		)
+
+		// the head element is slow, so the window fills up behind it
+		release := make(chan struct{})
+		out := Map(ctx, p, slice2chan(genInts(50)), func(x int) int {
+			if x == 0 {
+				<-release
+			}
+			return x
+		}, WithParallel(2))
+		res := make(chan []int)
+		go func() { res <- chan2slice(out) }()
+
+		waitDiagnosis(t, p, "map-1", StageRunning)
+		advance(clock)
+		close(release)
+
+		got := <-res
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, genInts(50), got)
+	})
+}
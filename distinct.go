@@ -0,0 +1,103 @@
+package chankit
+
+import (
+	"container/list"
+	"context"
+	"time"
+)
+
+// DistinctUntilChanged forwards elements from `in` whose key, computed with
+// `keyFn`, differs from the key of the previous element.
+//
+// It closes the returned channel after input is fully consumed.
+// If ctx is canceled, it stops early and returns.
+func DistinctUntilChanged[A any, K comparable](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	keyFn func(A) K,
+	opts ...Option,
+) <-chan A {
+	var last K
+	var seen bool
+
+	return Filter(ctx, p, in, func(a A) bool {
+		k := keyFn(a)
+		if seen && k == last {
+			return false
+		}
+		last, seen = k, true
+		return true
+	}, opts...)
+}
+
+// Distinct forwards elements from `in` whose key, computed with `keyFn`,
+// was not seen before.
+//
+// By default every key is remembered forever. Memory can be bounded with:
+//
+//   - WithMaxKeys: remember at most n keys, forgetting the least recently
+//     seen one first;
+//   - WithKeyTTL: forget a key d after it was first seen (see WithClock);
+//   - WithBloomFilter: remember keys approximately in fixed memory. Some
+//     never-seen elements may be dropped as false positives. It takes
+//     precedence over the other bounds.
+//
+// A forgotten key is forwarded again when it reappears.
+// It closes the returned channel after input is fully consumed.
+// If ctx is canceled, it stops early and returns.
+func Distinct[A any, K comparable](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	keyFn func(A) K,
+	opts ...Option,
+) <-chan A {
+	cfg := makeConfig(opts)
+
+	if cfg.keyed.bloomKeys > 0 {
+		bloom := newBloomFilter[K](cfg.keyed.bloomKeys, cfg.keyed.bloomFPRate)
+		return Filter(ctx, p, in, func(a A) bool { return !bloom.add(keyFn(a)) }, opts...)
+	}
+
+	type entry struct {
+		key     K
+		expires time.Time
+	}
+
+	clock := cfg.clock
+	ttl := cfg.keyed.ttl
+	maxKeys := cfg.keyed.maxKeys
+
+	// ordered from oldest to newest; without TTL, hits move keys to the back
+	order := list.New()
+	index := make(map[K]*list.Element)
+
+	forget := func(el *list.Element) {
+		delete(index, order.Remove(el).(*entry).key)
+	}
+
+	return Filter(ctx, p, in, func(a A) bool {
+		var now time.Time
+		if ttl > 0 {
+			now = clock.Now()
+			for order.Len() > 0 && !order.Front().Value.(*entry).expires.After(now) {
+				forget(order.Front())
+			}
+		}
+
+		k := keyFn(a)
+		if el, ok := index[k]; ok {
+			if ttl == 0 {
+				order.MoveToBack(el)
+			}
+			return false
+		}
+
+		if maxKeys > 0 && order.Len() >= maxKeys {
+			forget(order.Front())
+		}
+		index[k] = order.PushBack(&entry{key: k, expires: now.Add(ttl)})
+		return true
+	}, opts...)
+}
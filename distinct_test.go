@@ -0,0 +1,107 @@
+package chankit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDistinctUntilChanged(t *testing.T) {
+	t.Parallel()
+
+	p, ctx := NewPipeline(t.Context())
+	in := slice2chan([]int{1, 1, 2, 2, 2, 1, 3, 3})
+	got := chan2slice(DistinctUntilChanged(ctx, p, in, func(v int) int { return v }))
+
+	assertNoPipeError(t, p)
+	assertSlicesEqual(t, []int{1, 2, 1, 3}, got)
+}
+
+func TestDistinct(t *testing.T) {
+	id := func(v int) int { return v }
+
+	tests := []struct {
+		name string
+		opts []Option
+		in   []int
+		want []int
+	}{
+		{"unbounded", nil, []int{1, 2, 1, 3, 2, 4}, []int{1, 2, 3, 4}},
+		{"lru", []Option{WithMaxKeys(2)}, []int{1, 2, 1, 3, 1, 2}, []int{1, 2, 3, 2}},
+		{
+			"bloom",
+			[]Option{WithBloomFilter(1_000, 0.0001)},
+			[]int{1, 2, 1, 3, 2, 4},
+			[]int{1, 2, 3, 4},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, ctx := NewPipeline(t.Context())
+			got := chan2slice(Distinct(ctx, p, slice2chan(tc.in), id, tc.opts...))
+
+			assertNoPipeError(t, p)
+			assertSlicesEqual(t, tc.want, got)
+		})
+	}
+
+	t.Run("ttl", func(t *testing.T) {
+		t.Parallel()
+
+		clock := newFakeClock()
+		in := make(chan int)
+
+		p, ctx := NewPipeline(t.Context())
+		out := Distinct(ctx, p, in, id, WithKeyTTL(time.Minute), WithClock(clock))
+
+		expect := func(want int) {
+			t.Helper()
+			if v := <-out; v != want {
+				t.Fatalf("expected %d, got %d", want, v)
+			}
+		}
+
+		in <- 1
+		expect(1)
+		in <- 1 // duplicate
+		in <- 2
+		expect(2)
+
+		clock.Advance(time.Minute)
+		in <- 1 // expired
+		expect(1)
+		in <- 2 // expired
+		expect(2)
+		close(in)
+
+		assertNoPipeError(t, p)
+	})
+}
+
+func TestBloomFilter(t *testing.T) {
+	t.Parallel()
+
+	n := 10_000
+	bf := newBloomFilter[int](n, 0.01)
+
+	for i := range n {
+		bf.add(i)
+	}
+	for i := range n {
+		if !bf.add(i) {
+			t.Fatalf("false negative for %d", i)
+		}
+	}
+
+	fp, probes := 0, 1_000
+	for i := n; i < n+probes; i++ {
+		if bf.add(i) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / float64(probes); rate > 0.03 {
+		t.Fatalf("false positive rate too high: %.4f", rate)
+	}
+}
@@ -2,4 +2,11 @@ package chankit
 
 import "errors"
 
-var ErrUnknownHaltStrategy = errors.New("unknown halt strategy")
+var (
+	ErrUnknownHaltStrategy = errors.New("unknown halt strategy")
+	ErrLengthMismatch      = errors.New("input streams have different lengths")
+	ErrElementTimeout      = errors.New("element processing timed out")
+	ErrIdleTimeout         = errors.New("no element received within timeout")
+	ErrCircuitOpen         = errors.New("circuit breaker is open")
+	ErrStageStalled        = errors.New("stage blocked sending")
+)
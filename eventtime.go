@@ -0,0 +1,284 @@
+package chankit
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+)
+
+// WatermarkStrategy decides how far event time must progress before a
+// window is considered complete.
+type WatermarkStrategy struct {
+	maxDelay time.Duration
+}
+
+// BoundedOutOfOrderness tolerates elements arriving up to maxDelay behind the
+// largest timestamp seen so far: the watermark trails that timestamp by
+// maxDelay.
+func BoundedOutOfOrderness(maxDelay time.Duration) WatermarkStrategy {
+	return WatermarkStrategy{maxDelay: max(maxDelay, 0)}
+}
+
+// EventTimeWindows groups elements from `in` into windows by their own
+// timestamps, extracted with `tsFn`.
+//
+// A window is emitted once the watermark (see WatermarkStrategy) passes its
+// end. With WithAllowedLateness, a window is kept for that long after it was
+// emitted: an element arriving in that period is added to it and the updated
+// window is emitted again, replacing the previous result. Elements arriving
+// after all their windows expired are sent to the returned late channel.
+//
+// The late channel must be consumed like the windows one: a late element is
+// sent synchronously (or into the WithBuffer buffer), so the stage blocks,
+// and the pipeline stalls, until it is read. Callers that do not need late
+// elements should discard them, e.g. with `go func() { for range late {} }()`.
+//
+// Both returned channels are closed after input is fully consumed; windows
+// still open at that point are emitted first.
+// If ctx is canceled, it stops early and returns.
+func EventTimeWindows[A any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	tsFn func(A) time.Time,
+	spec WindowSpec,
+	wm WatermarkStrategy,
+	opts ...Option,
+) (<-chan Window[A], <-chan A) {
+	return foldEventTimeWindows(
+		ctx,
+		p,
+		in,
+		tsFn,
+		spec,
+		wm,
+		nil,
+		func(items []A, a A) []A { return append(items, a) },
+		func(w WindowAgg[[]A]) Window[A] {
+			return Window[A]{Start: w.Start, End: w.End, Items: w.Acc}
+		},
+		opts...)
+}
+
+// FoldEventTimeWindows is like EventTimeWindows, but reduces the elements of
+// each window into an accumulator using `f`.
+//
+// Every window starts from `init` and `f` is applied in arrival order.
+// Fixed-size windows are reduced in place; session windows may merge when an
+// out-of-order element bridges them, so their elements are retained until the
+// session expires.
+//
+// As with EventTimeWindows, the returned late channel must be consumed or
+// the stage blocks on the first late element.
+func FoldEventTimeWindows[A, B any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	tsFn func(A) time.Time,
+	spec WindowSpec,
+	wm WatermarkStrategy,
+	init B,
+	f func(B, A) B,
+	opts ...Option,
+) (<-chan WindowAgg[B], <-chan A) {
+	identity := func(w WindowAgg[B]) WindowAgg[B] { return w }
+	return foldEventTimeWindows(ctx, p, in, tsFn, spec, wm, init, f, identity, opts...)
+}
+
+// foldEventTimeWindows implements FoldEventTimeWindows, converting every
+// emitted window with `conv`.
+func foldEventTimeWindows[A, B, C any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	tsFn func(A) time.Time,
+	spec WindowSpec,
+	wm WatermarkStrategy,
+	init B,
+	f func(B, A) B,
+	conv func(WindowAgg[B]) C,
+	opts ...Option,
+) (<-chan C, <-chan A) {
+	cfg := makeConfig(opts)
+	out, ret := makeOut[C](ctx, p, cfg)
+	late := make(chan A, cfg.bufCap)
+	st, ctx := p.newStage(ctx, cfg, "event-time-windows", ret, in)
+	defer st.launched()
+
+	type item struct {
+		seq int64
+		val A
+	}
+
+	type window struct {
+		start time.Time
+		end   time.Time
+		acc   B
+		items []item // session windows only
+		fired bool
+	}
+
+	lateness := cfg.lateness
+	session := spec.kind == windowSession
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		defer close(late)
+		pr := st.probe()
+		defer pr.stop()
+
+		// ordered by start
+		var windows []*window
+		var maxTs time.Time
+		var seen bool
+
+		expired := func(end, watermark time.Time) bool {
+			return seen && !end.Add(lateness).After(watermark)
+		}
+
+		result := func(w *window) WindowAgg[B] {
+			acc := w.acc
+			if session {
+				acc = init
+				for _, it := range w.items {
+					acc = f(acc, it.val)
+				}
+			}
+			return WindowAgg[B]{Start: w.start, End: w.end, Acc: acc}
+		}
+
+		advance := func(watermark time.Time, final bool) error {
+			kept := windows[:0]
+			for _, w := range windows {
+				if !w.fired && (final || !w.end.After(watermark)) {
+					pr.set(StageSending)
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case out <- conv(result(w)):
+						st.emit(len(out))
+					}
+					w.fired = true
+				}
+				if final || expired(w.end, watermark) {
+					continue
+				}
+				kept = append(kept, w)
+			}
+			clear(windows[len(kept):])
+			windows = kept
+			return nil
+		}
+
+		assignFixed := func(ts time.Time, a A, watermark time.Time) bool {
+			starts := spec.starts(ts)
+			assigned := false
+			for _, start := range starts {
+				end := start.Add(spec.size)
+				if expired(end, watermark) {
+					continue
+				}
+				i, found := slices.BinarySearchFunc(
+					windows,
+					start,
+					func(w *window, t time.Time) int { return w.start.Compare(t) },
+				)
+				if !found {
+					windows = slices.Insert(windows, i, &window{start: start, end: end, acc: init})
+				}
+				windows[i].acc = f(windows[i].acc, a)
+				windows[i].fired = false
+				assigned = true
+			}
+			return assigned || len(starts) == 0
+		}
+
+		assignSession := func(ts time.Time, it item, watermark time.Time) bool {
+			merged := &window{start: ts, end: ts.Add(spec.gap), items: []item{it}}
+			kept := windows[:0]
+			overlaps := false
+			for _, w := range windows {
+				if w.start.Before(merged.end) && merged.start.Before(w.end) {
+					merged.start = minTime(merged.start, w.start)
+					merged.end = maxTime(merged.end, w.end)
+					merged.items = append(merged.items, w.items...)
+					overlaps = true
+					continue
+				}
+				kept = append(kept, w)
+			}
+			if !overlaps && expired(merged.end, watermark) {
+				return false
+			}
+			clear(windows[len(kept):])
+			windows = kept
+
+			slices.SortFunc(merged.items, func(x, y item) int { return cmp.Compare(x.seq, y.seq) })
+			i, _ := slices.BinarySearchFunc(
+				windows,
+				merged.start,
+				func(w *window, t time.Time) int { return w.start.Compare(t) },
+			)
+			windows = slices.Insert(windows, i, merged)
+			return true
+		}
+
+		for seq := int64(0); ; seq++ {
+			pr.set(StageReading)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case a, ok := <-in:
+				if !ok {
+					return advance(time.Time{}, true)
+				}
+				pr.receive()
+
+				ts := tsFn(a)
+				watermark := maxTs.Add(-wm.maxDelay)
+
+				var assigned bool
+				if session {
+					assigned = assignSession(ts, item{seq, a}, watermark)
+				} else {
+					assigned = assignFixed(ts, a, watermark)
+				}
+
+				if !assigned {
+					pr.set(StageSending)
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case late <- a:
+					}
+					continue
+				}
+
+				if !seen || ts.After(maxTs) {
+					maxTs = ts
+					seen = true
+				}
+				if err := advance(maxTs.Add(-wm.maxDelay), false); err != nil {
+					return err
+				}
+			}
+		}
+	})
+
+	return ret, late
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
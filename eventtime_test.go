@@ -0,0 +1,153 @@
+package chankit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventTimeWindows(t *testing.T) {
+	base := time.Unix(0, 0)
+	tsFn := func(sec int) time.Time { return base.Add(time.Duration(sec) * time.Second) }
+
+	type window struct {
+		start, end int
+		items      []int
+	}
+
+	tests := []struct {
+		name     string
+		spec     WindowSpec
+		maxDelay time.Duration
+		lateness time.Duration
+		in       []int
+		want     []window
+		wantLate []int
+	}{
+		{
+			"in order",
+			TumblingWindow(10 * time.Second),
+			0,
+			0,
+			[]int{1, 2, 11, 25},
+			[]window{{0, 10, []int{1, 2}}, {10, 20, []int{11}}, {20, 30, []int{25}}},
+			nil,
+		},
+		{
+			"late element",
+			TumblingWindow(10 * time.Second),
+			0,
+			0,
+			[]int{1, 2, 11, 3, 25},
+			[]window{{0, 10, []int{1, 2}}, {10, 20, []int{11}}, {20, 30, []int{25}}},
+			[]int{3},
+		},
+		{
+			"bounded out of orderness",
+			TumblingWindow(10 * time.Second),
+			5 * time.Second,
+			0,
+			[]int{1, 11, 3, 16},
+			[]window{{0, 10, []int{1, 3}}, {10, 20, []int{11, 16}}},
+			nil,
+		},
+		{
+			"allowed lateness",
+			TumblingWindow(10 * time.Second),
+			0,
+			10 * time.Second,
+			[]int{1, 11, 3, 25, 4},
+			[]window{
+				{0, 10, []int{1}},
+				{0, 10, []int{1, 3}},
+				{10, 20, []int{11}},
+				{20, 30, []int{25}},
+			},
+			[]int{4},
+		},
+		{
+			"sliding",
+			SlidingWindow(10*time.Second, 5*time.Second),
+			0,
+			0,
+			[]int{7, 12},
+			[]window{{0, 10, []int{7}}, {5, 15, []int{7, 12}}, {10, 20, []int{12}}},
+			nil,
+		},
+		{
+			"session merge",
+			SessionWindow(5 * time.Second),
+			10 * time.Second,
+			0,
+			[]int{1, 8, 4, 30},
+			[]window{{1, 13, []int{1, 8, 4}}, {30, 35, []int{30}}},
+			nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, ctx := NewPipeline(t.Context())
+			out, late := EventTimeWindows(
+				ctx,
+				p,
+				slice2chan(tc.in),
+				tsFn,
+				tc.spec,
+				BoundedOutOfOrderness(tc.maxDelay),
+				WithAllowedLateness(tc.lateness),
+			)
+
+			lateCh := make(chan []int)
+			go func() { lateCh <- chan2slice(late) }()
+
+			got := chan2slice(out)
+			gotLate := <-lateCh
+			assertNoPipeError(t, p)
+
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %d windows, got %v", len(tc.want), got)
+			}
+			for i, w := range tc.want {
+				if !got[i].Start.Equal(tsFn(w.start)) || !got[i].End.Equal(tsFn(w.end)) {
+					t.Fatalf("window %d: expected [%d, %d), got %v", i, w.start, w.end, got[i])
+				}
+				assertSlicesEqual(t, w.items, got[i].Items)
+			}
+			assertSlicesEqual(t, tc.wantLate, gotLate)
+		})
+	}
+}
+
+func TestEventTimeWindowsOptions(t *testing.T) {
+	t.Parallel()
+
+	tsFn := func(x int) time.Time { return time.Unix(int64(x), 0) }
+
+	p, ctx := NewPipeline(t.Context())
+	out, late := EventTimeWindows(
+		ctx,
+		p,
+		slice2chan([]int{1, 2}),
+		tsFn,
+		TumblingWindow(10*time.Second),
+		BoundedOutOfOrderness(0),
+		WithBuffer(4),
+		WithName("windows"),
+	)
+
+	if c, lc := cap(out), cap(late); c != 4 || lc != 4 {
+		t.Fatalf("expected buffers of 4, got %d and %d", c, lc)
+	}
+	for range out {
+	}
+	for range late {
+	}
+	assertNoPipeError(t, p)
+
+	nodes := p.Graph().Nodes
+	if len(nodes) != 2 || nodes[0].Name != "windows" || nodes[1].Kind != "input" {
+		t.Fatalf("expected a single windows stage, got %+v", nodes)
+	}
+}
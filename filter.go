@@ -1,6 +1,10 @@
 package chankit
 
-import "context"
+import (
+	"context"
+	"log/slog"
+	"time"
+)
 
 // Filter forwards elements from `in` that satisfy `pred`.
 //
@@ -54,12 +58,18 @@ func FilterErrCtx[A any](
 	opts ...Option,
 ) <-chan A {
 	cfg := makeConfig(opts)
-	out := make(chan A, cfg.bufCap)
+	out, ret := makeOut[A](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "filter", ret, in)
+	defer st.launched()
+	pred = limitedFunc(cfg, observedFunc(st.obs, tracedFunc(p.stageTracer(cfg), st.info, pred)))
 
-	p.goSafe(func() error {
+	p.goSafe(ctx, func() error {
 		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
 
 		for {
+			pr.set(StageReading)
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
@@ -67,6 +77,7 @@ func FilterErrCtx[A any](
 				if !ok {
 					return nil
 				}
+				pr.receive()
 
 				p, err := pred(ctx, a)
 				if err != nil {
@@ -74,17 +85,19 @@ func FilterErrCtx[A any](
 				}
 
 				if p {
+					pr.set(StageSending)
 					select {
 					case <-ctx.Done():
 						return ctx.Err()
 					case out <- a:
+						st.emit(len(out))
 					}
 				}
 			}
 		}
 	})
 
-	return out
+	return ret
 }
 
 // Take forwards at most `n` elements from `in` to the returned channel.
@@ -93,7 +106,9 @@ func FilterErrCtx[A any](
 //
 //   - it continues to drain and discard any further values from in
 //     until `in` is closed or `ctx` is cancelled, so that upstream senders
-//     never block.
+//     never block;
+//   - or, with WithUpstreamCancel, it cancels the upstream stages instead,
+//     which avoids wasting work on expensive or infinite upstreams.
 //
 // The returned channel is then closed.
 // If ctx is cancelled before `n` elements are seen, Take stops immediately
@@ -108,18 +123,26 @@ func Take[A any](
 	opts ...Option,
 ) <-chan A {
 	cfg := makeConfig(opts)
-	out := make(chan A, cfg.bufCap)
+	out, ret := makeOut[A](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "take", ret, in)
+	defer st.launched()
 
 	if n <= 0 {
+		if cfg.upstreamCancel != nil {
+			cfg.upstreamCancel()
+		}
 		close(out)
-		return out
+		return ret
 	}
 
-	p.goSafe(func() error {
+	p.goSafe(ctx, func() error {
 		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
 
 		taken := 0
 		for {
+			pr.set(StageReading)
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
@@ -127,37 +150,27 @@ func Take[A any](
 				if !ok {
 					return nil
 				}
+				st.receive()
 
+				pr.set(StageSending)
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
 				case out <- v:
+					st.emit(len(out))
 				}
 
 				taken++
 
 				if taken == n {
-					// drain
-					p.goSafe(func() error {
-						for {
-							select {
-							case <-ctx.Done():
-								return ctx.Err()
-							case _, ok := <-in:
-								if !ok {
-									return nil
-								}
-							}
-						}
-					})
-
+					stopUpstream(ctx, p, in, cfg)
 					return nil
 				}
 			}
 		}
 	})
 
-	return out
+	return ret
 }
 
 func Drop[A any](
@@ -172,11 +185,17 @@ func Drop[A any](
 	}
 
 	cfg := makeConfig(opts)
-	out := make(chan A, cfg.bufCap)
+	out, ret := makeOut[A](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "drop", ret, in)
+	defer st.launched()
 
-	p.goSafe(func() error {
+	p.goSafe(ctx, func() error {
 		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
 		for {
+			pr.set(StageReading)
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
@@ -184,20 +203,457 @@ func Drop[A any](
 				if !ok {
 					return nil
 				}
+				st.receive()
 
 				if n > 0 {
 					n--
 					continue
 				}
 
+				pr.set(StageSending)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case out <- a:
+					st.emit(len(out))
+				}
+			}
+		}
+	})
+
+	return ret
+}
+
+// TakeWhile forwards elements from `in` while they satisfy `pred`.
+//
+// The first element that does not satisfy `pred` is discarded and the
+// returned channel is closed. Like Take, it then drains `in` in the
+// background so that upstream senders never block, or, with
+// WithUpstreamCancel, cancels the upstream stages instead.
+// If ctx is cancelled, it stops immediately and closes the channel.
+func TakeWhile[A any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	pred func(A) bool,
+	opts ...Option,
+) <-chan A {
+	cfg := makeConfig(opts)
+	out, ret := makeOut[A](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "take-while", ret, in)
+	defer st.launched()
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		for {
+			pr.set(StageReading)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case a, ok := <-in:
+				if !ok {
+					return nil
+				}
+				pr.receive()
+
+				if !pred(a) {
+					stopUpstream(ctx, p, in, cfg)
+					return nil
+				}
+
+				pr.set(StageSending)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case out <- a:
+					st.emit(len(out))
+				}
+			}
+		}
+	})
+
+	return ret
+}
+
+// DropWhile discards elements from `in` while they satisfy `pred`, then
+// forwards the first element that does not and everything after it.
+//
+// It closes the returned channel after input is fully consumed.
+// If ctx is canceled, it stops early and returns.
+func DropWhile[A any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	pred func(A) bool,
+	opts ...Option,
+) <-chan A {
+	cfg := makeConfig(opts)
+	out, ret := makeOut[A](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "drop-while", ret, in)
+	defer st.launched()
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		dropping := true
+		for {
+			pr.set(StageReading)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case a, ok := <-in:
+				if !ok {
+					return nil
+				}
+				pr.receive()
+
+				if dropping && pred(a) {
+					continue
+				}
+				dropping = false
+
+				pr.set(StageSending)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case out <- a:
+					st.emit(len(out))
+				}
+			}
+		}
+	})
+
+	return ret
+}
+
+// TakeUntil forwards elements from `in` until `signal` receives a value or
+// is closed.
+//
+// The returned channel is then closed. Like Take, it then drains `in` in the
+// background so that upstream senders never block, or, with
+// WithUpstreamCancel, cancels the upstream stages instead.
+// If ctx is cancelled, it stops immediately and closes the channel.
+func TakeUntil[A any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	signal <-chan struct{},
+	opts ...Option,
+) <-chan A {
+	cfg := makeConfig(opts)
+	out, ret := makeOut[A](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "take-until", ret, in, signal)
+	defer st.launched()
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		for {
+			pr.set(StageReading)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-signal:
+				stopUpstream(ctx, p, in, cfg)
+				return nil
+			case a, ok := <-in:
+				if !ok {
+					return nil
+				}
+				st.receive()
+
+				pr.set(StageSending)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-signal:
+					stopUpstream(ctx, p, in, cfg)
+					return nil
+				case out <- a:
+					st.emit(len(out))
+				}
+			}
+		}
+	})
+
+	return ret
+}
+
+// SkipUntil discards elements from `in` until `signal` receives a value or
+// is closed, then forwards everything after it.
+//
+// A nil signal never fires, so every element is discarded.
+// It closes the returned channel after input is fully consumed.
+// If ctx is canceled, it stops early and returns.
+func SkipUntil[A any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	signal <-chan struct{},
+	opts ...Option,
+) <-chan A {
+	cfg := makeConfig(opts)
+	out, ret := makeOut[A](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "skip-until", ret, in, signal)
+	defer st.launched()
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		skipping := true
+		for {
+			pr.set(StageReading)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-signal:
+				skipping = false
+				signal = nil
+			case a, ok := <-in:
+				if !ok {
+					return nil
+				}
+				st.receive()
+
+				if skipping {
+					select {
+					case <-signal:
+						skipping = false
+						signal = nil
+					default:
+						continue
+					}
+				}
+
+				pr.set(StageSending)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case out <- a:
+					st.emit(len(out))
+				}
+			}
+		}
+	})
+
+	return ret
+}
+
+// Timeout forwards elements from `in` and fails the pipeline with
+// ErrIdleTimeout when no element arrives within `d` of the previous one (or
+// of the start).
+//
+// Time is measured with the stage clock (see WithClock), and only while
+// waiting for input, so a slow downstream does not trigger it.
+// It closes the returned channel after input is fully consumed or on error.
+// If ctx is canceled, it stops early and returns.
+func Timeout[A any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	d time.Duration,
+	opts ...Option,
+) <-chan A {
+	fail := func(context.Context, chan<- A) error { return ErrIdleTimeout }
+	return timeoutImpl(ctx, p, in, d, fail, opts...)
+}
+
+// TimeoutWith is like Timeout, but instead of failing the pipeline it emits
+// `sentinel` and closes the returned channel. Like Take, it then drains `in`
+// in the background, or, with WithUpstreamCancel, cancels the upstream
+// stages instead.
+func TimeoutWith[A any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	d time.Duration,
+	sentinel A,
+	opts ...Option,
+) <-chan A {
+	cfg := makeConfig(opts)
+
+	return timeoutImpl(ctx, p, in, d, func(ctx context.Context, out chan<- A) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case out <- sentinel:
+			stageFrom(ctx).emit(len(out))
+		}
+		stopUpstream(ctx, p, in, cfg)
+		return nil
+	}, opts...)
+}
+
+func timeoutImpl[A any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	d time.Duration,
+	onTimeout func(ctx context.Context, out chan<- A) error,
+	opts ...Option,
+) <-chan A {
+	if d <= 0 {
+		panic("d must be > 0")
+	}
+
+	cfg := makeConfig(opts)
+	out, ret := makeOut[A](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "timeout", ret, in)
+	defer st.launched()
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		timer := cfg.clock.NewTimer(d)
+		defer timer.Stop()
+
+		for {
+			pr.set(StageReading)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C():
+				pr.set(StageSending) // a sentinel, if any
+				return onTimeout(ctx, out)
+			case a, ok := <-in:
+				if !ok {
+					return nil
+				}
+				st.receive()
+
+				pr.set(StageSending)
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
 				case out <- a:
+					st.emit(len(out))
+				}
+
+				timer.Stop()
+				timer.Reset(d)
+			}
+		}
+	})
+
+	return ret
+}
+
+// Heartbeat forwards elements from `in` and emits `tick` whenever no element
+// arrived for `d`, repeating every `d` of continued silence.
+//
+// Time is measured with the stage clock (see WithClock), and only while
+// waiting for input.
+// It closes the returned channel after input is fully consumed.
+// If ctx is canceled, it stops early and returns.
+func Heartbeat[A any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	d time.Duration,
+	tick A,
+	opts ...Option,
+) <-chan A {
+	if d <= 0 {
+		panic("d must be > 0")
+	}
+
+	cfg := makeConfig(opts)
+	out, ret := makeOut[A](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "heartbeat", ret, in)
+	defer st.launched()
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		timer := cfg.clock.NewTimer(d)
+		defer timer.Stop()
+
+		for {
+			var a A
+			pr.set(StageReading)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timer.C():
+				a = tick
+			case v, ok := <-in:
+				if !ok {
+					return nil
 				}
+				st.receive()
+				a = v
+			}
+
+			pr.set(StageSending)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case out <- a:
+				st.emit(len(out))
 			}
+
+			timer.Stop()
+			timer.Reset(d)
 		}
 	})
 
-	return out
+	return ret
+}
+
+// stopUpstream releases the stages feeding `in` once a stage needs no more
+// elements: they are either cancelled (see WithUpstreamCancel) or drained.
+func stopUpstream[A any](ctx context.Context, p *Pipeline, in <-chan A, cfg *config) {
+	if cfg.upstreamCancel != nil {
+		cfg.upstreamCancel()
+		return
+	}
+	drain(ctx, p, in)
+}
+
+// drain discards the rest of `in` in the background until it is closed or
+// ctx is cancelled, so that upstream senders never block. The number of
+// discarded elements is logged (see WithLogger).
+func drain[A any](ctx context.Context, p *Pipeline, in <-chan A) {
+	p.goSafe(ctx, func() error {
+		if st := stageFrom(ctx); st != nil {
+			pr := st.probe()
+			defer pr.stop()
+		}
+
+		var drained int64
+		if p.log != nil {
+			defer func() {
+				attrs := []any{slog.String("pipeline", p.name)}
+				if st := stageFrom(ctx); st != nil {
+					attrs = st.attrs()
+				}
+				p.log.Debug("stage drained", append(attrs, slog.Int64("drained", drained))...)
+			}()
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case _, ok := <-in:
+				if !ok {
+					return nil
+				}
+				drained++
+			}
+		}
+	})
 }
@@ -146,6 +146,33 @@ func ExampleTake_finiteProducer() {
 	// 4
 }
 
+func ExampleTake_upstreamCancel() {
+	p, ctx := chankit.NewPipeline(context.Background())
+
+	// stages feeding Take run in their own scope
+	upCtx, cancelUp := chankit.UpstreamScope(ctx)
+	in := tickerProducer(upCtx)
+	squared := chankit.Map(upCtx, p, in, func(v int) int { return v * v })
+
+	// takes first 5 elements, then cancels the upstream stages
+	out := chankit.Take(ctx, p, squared, 5, chankit.WithUpstreamCancel(cancelUp))
+
+	for v := range out {
+		fmt.Println(v)
+	}
+
+	if err := p.Wait(); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// 0
+	// 1
+	// 4
+	// 9
+	// 16
+}
+
 func ExampleDrop() {
 	p, ctx := chankit.NewPipeline(context.Background())
 
@@ -192,7 +219,11 @@ func tickerProducer(ctx context.Context) <-chan int {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				out <- i
+				select {
+				case <-ctx.Done():
+					return
+				case out <- i:
+				}
 			}
 		}
 	}()
@@ -2,7 +2,10 @@ package chankit
 
 import (
 	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func FuzzFilter(f *testing.F) {
@@ -69,6 +72,37 @@ func TestTake(t *testing.T) {
 	}
 }
 
+func TestTakeUpstreamCancel(t *testing.T) {
+	t.Parallel()
+
+	var produced int32
+
+	p, ctx := NewPipeline(t.Context())
+	upCtx, cancelUp := UpstreamScope(ctx)
+
+	in := CreateProducer(upCtx, WithCounter(&produced))
+	mapped := MapErrCtx(
+		upCtx,
+		p,
+		in,
+		func(ctx context.Context, v int) (int, error) { return v, ctx.Err() },
+		WithParallel(4),
+		WithBuffer(8),
+	)
+	out := Take(ctx, p, mapped, 10, WithUpstreamCancel(cancelUp))
+	got := chan2slice(out)
+
+	assertNoPipeError(t, p)
+	assertSlicesEqual(t, genInts(10), got)
+
+	// the producer stopped instead of being drained forever
+	n := atomic.LoadInt32(&produced)
+	time.Sleep(10 * time.Millisecond)
+	if m := atomic.LoadInt32(&produced); m != n {
+		t.Fatalf("producer still running: %d -> %d", n, m)
+	}
+}
+
 func TestDrop(t *testing.T) {
 	tests := []struct {
 		name string
@@ -97,6 +131,86 @@ func TestDrop(t *testing.T) {
 	}
 }
 
+func TestTimeout(t *testing.T) {
+	t.Run("active input", func(t *testing.T) {
+		t.Parallel()
+
+		clock := newFakeClock()
+		p, ctx := NewPipeline(t.Context())
+		in := CreateProducer(ctx, WithLimit(20))
+		got := chan2slice(Timeout(ctx, p, in, time.Second, WithClock(clock)))
+
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, genInts(20), got)
+	})
+
+	t.Run("idle input", func(t *testing.T) {
+		t.Parallel()
+
+		clock := newFakeClock()
+		d := 10 * time.Millisecond
+		in := make(chan int)
+		p, ctx := NewPipeline(t.Context())
+		out := Timeout(ctx, p, in, d, WithClock(clock))
+
+		in <- 1
+		if v := <-out; v != 1 {
+			t.Fatalf("expected 1, got %d", v)
+		}
+		rest := collectAdvancing(t, clock, d, out)
+
+		if err := p.Wait(); !errors.Is(err, ErrIdleTimeout) {
+			t.Fatalf("expected %v, got %v", ErrIdleTimeout, err)
+		}
+		assertSlicesEqual(t, nil, rest)
+	})
+
+	t.Run("sentinel", func(t *testing.T) {
+		t.Parallel()
+
+		clock := newFakeClock()
+		d := 10 * time.Millisecond
+		in := make(chan int)
+		p, ctx := NewPipeline(t.Context())
+		out := TimeoutWith(ctx, p, in, d, -1, WithClock(clock))
+
+		in <- 1
+		if v := <-out; v != 1 {
+			t.Fatalf("expected 1, got %d", v)
+		}
+		rest := collectAdvancing(t, clock, d, out)
+		close(in)
+
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, []int{-1}, rest)
+	})
+}
+
+func TestHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	clock := newFakeClock()
+	d := 10 * time.Millisecond
+	in := make(chan int)
+	p, ctx := NewPipeline(t.Context())
+	out := Heartbeat(ctx, p, in, d, -1, WithClock(clock))
+
+	in <- 1
+	if v := <-out; v != 1 {
+		t.Fatalf("expected 1, got %d", v)
+	}
+	for range 2 {
+		if v, _ := recvAdvancing(t, clock, d, out); v != -1 {
+			t.Fatalf("expected tick, got %d", v)
+		}
+	}
+	close(in)
+
+	for range out {
+	}
+	assertNoPipeError(t, p)
+}
+
 func filterInts(in []int, pred func(x int) bool) []int {
 	var out []int
 	for v := range in {
@@ -106,3 +220,126 @@ func filterInts(in []int, pred func(x int) bool) []int {
 	}
 	return out
 }
+
+func TestTakeWhile(t *testing.T) {
+	lessThan := func(n int) func(int) bool { return func(v int) bool { return v < n } }
+
+	t.Run("finite", func(t *testing.T) {
+		t.Parallel()
+
+		p, ctx := NewPipeline(t.Context())
+		out := TakeWhile(ctx, p, slice2chan([]int{1, 2, 3, 1, 2}), lessThan(3))
+		got := chan2slice(out)
+
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, []int{1, 2}, got)
+	})
+
+	t.Run("infinite drain", func(t *testing.T) {
+		t.Parallel()
+
+		prodCtx, prodCancel := context.WithCancel(t.Context())
+		defer prodCancel()
+
+		p, ctx := NewPipeline(t.Context())
+		out := TakeWhile(ctx, p, CreateProducer(prodCtx), lessThan(5))
+		got := chan2slice(out)
+
+		prodCancel()
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, []int{0, 1, 2, 3, 4}, got)
+	})
+
+	t.Run("infinite upstream cancel", func(t *testing.T) {
+		t.Parallel()
+
+		p, ctx := NewPipeline(t.Context())
+		upCtx, cancelUp := UpstreamScope(ctx)
+
+		in := CreateProducer(upCtx)
+		mapped := Map(upCtx, p, in, func(v int) int { return v * 2 }, WithParallel(4))
+		out := TakeWhile(ctx, p, mapped, lessThan(10), WithUpstreamCancel(cancelUp))
+		got := chan2slice(out)
+
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, []int{0, 2, 4, 6, 8}, got)
+	})
+}
+
+func TestDropWhile(t *testing.T) {
+	t.Parallel()
+
+	p, ctx := NewPipeline(t.Context())
+	out := DropWhile(ctx, p, slice2chan([]int{1, 2, 3, 1, 2}), func(v int) bool { return v < 3 })
+	got := chan2slice(out)
+
+	assertNoPipeError(t, p)
+	assertSlicesEqual(t, []int{3, 1, 2}, got)
+}
+
+func TestTakeUntil(t *testing.T) {
+	t.Run("signal", func(t *testing.T) {
+		t.Parallel()
+
+		in := make(chan int)
+		signal := make(chan struct{})
+
+		p, ctx := NewPipeline(t.Context())
+		out := TakeUntil(ctx, p, in, signal)
+
+		in <- 1
+		if v := <-out; v != 1 {
+			t.Fatalf("expected 1, got %d", v)
+		}
+		close(signal)
+
+		if rest := chan2slice(out); len(rest) != 0 {
+			t.Fatalf("expected no more values, got %v", rest)
+		}
+		in <- 2 // drained
+		close(in)
+		assertNoPipeError(t, p)
+	})
+
+	t.Run("input closed first", func(t *testing.T) {
+		t.Parallel()
+
+		p, ctx := NewPipeline(t.Context())
+		out := TakeUntil(ctx, p, slice2chan([]int{1, 2}), make(chan struct{}))
+		got := chan2slice(out)
+
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, []int{1, 2}, got)
+	})
+}
+
+func TestSkipUntil(t *testing.T) {
+	t.Run("signal", func(t *testing.T) {
+		t.Parallel()
+
+		in := make(chan int)
+		signal := make(chan struct{})
+
+		p, ctx := NewPipeline(t.Context())
+		out := SkipUntil(ctx, p, in, signal)
+
+		in <- 1
+		signal <- struct{}{}
+		in <- 2
+		close(in)
+
+		got := chan2slice(out)
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, []int{2}, got)
+	})
+
+	t.Run("never fires", func(t *testing.T) {
+		t.Parallel()
+
+		p, ctx := NewPipeline(t.Context())
+		got := chan2slice(SkipUntil(ctx, p, slice2chan([]int{1, 2}), nil))
+
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, nil, got)
+	})
+}
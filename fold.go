@@ -13,6 +13,7 @@ func Fold[A, B any](
 	in <-chan A,
 	init B,
 	f func(B, A) B,
+	opts ...Option,
 ) <-chan B {
 	return FoldErrCtx(
 		ctx,
@@ -20,6 +21,7 @@ func Fold[A, B any](
 		in,
 		init,
 		func(_ context.Context, acc B, a A) (B, error) { return f(acc, a), nil },
+		opts...,
 	)
 }
 
@@ -36,6 +38,7 @@ func FoldErr[A, B any](
 	in <-chan A,
 	init B,
 	f func(B, A) (B, error),
+	opts ...Option,
 ) <-chan B {
 	return FoldErrCtx(
 		ctx,
@@ -43,6 +46,7 @@ func FoldErr[A, B any](
 		in,
 		init,
 		func(_ context.Context, acc B, a A) (B, error) { return f(acc, a) },
+		opts...,
 	)
 }
 
@@ -59,25 +63,44 @@ func FoldErrCtx[A, B any](
 	in <-chan A,
 	init B,
 	f func(context.Context, B, A) (B, error),
+	opts ...Option,
 ) <-chan B {
+	cfg := makeConfig(opts)
 	out := make(chan B, 1)
+	st, ctx := p.newStage(ctx, cfg, "fold", out, in)
+	defer st.launched()
+	if obs := st.obs; obs != nil {
+		inner := f
+		f = func(ctx context.Context, acc B, a A) (B, error) {
+			start := obs.clock.Now()
+			acc, err := inner(ctx, acc, a)
+			obs.called(ctx, start, err)
+			return acc, err
+		}
+	}
 
-	p.goSafe(func() error {
+	p.goSafe(ctx, func() error {
 		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
 		acc := init
 
 		for {
+			pr.set(StageReading)
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
 			case a, ok := <-in:
 				if !ok {
+					pr.set(StageSending)
 					select {
 					case <-ctx.Done():
 					case out <- acc:
+						st.emit(len(out))
 					}
 					return nil
 				}
+				pr.receive()
 
 				var err error
 				acc, err = f(ctx, acc, a)
@@ -90,3 +113,110 @@ func FoldErrCtx[A, B any](
 
 	return out
 }
+
+// Scan reduces elements from `in` into an accumulator using `f` and emits
+// the accumulator after every element.
+//
+// Unlike Fold, it does not wait for the input to close, so it can be used
+// on infinite streams. The initial accumulator is not emitted.
+// It closes the returned channel after input is fully consumed.
+// If ctx is canceled, it stops early and returns.
+func Scan[A, B any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	init B,
+	f func(B, A) B,
+	opts ...Option,
+) <-chan B {
+	return ScanErrCtx(
+		ctx,
+		p,
+		in,
+		init,
+		func(_ context.Context, acc B, a A) (B, error) { return f(acc, a), nil },
+		opts...,
+	)
+}
+
+// ScanErr reduces elements from `in` into an accumulator using `f` and emits
+// the accumulator after every element.
+//
+// If f returns an error, the pipeline fails immediately and no more
+// accumulators are emitted.
+// It closes the returned channel after input is fully consumed or on error.
+// If ctx is canceled, it stops early and returns.
+func ScanErr[A, B any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	init B,
+	f func(B, A) (B, error),
+	opts ...Option,
+) <-chan B {
+	return ScanErrCtx(
+		ctx,
+		p,
+		in,
+		init,
+		func(_ context.Context, acc B, a A) (B, error) { return f(acc, a) },
+		opts...,
+	)
+}
+
+// ScanErrCtx reduces elements from `in` into an accumulator using `f` and
+// emits the accumulator after every element.
+//
+// If f returns an error, the pipeline fails immediately and no more
+// accumulators are emitted.
+// It closes the returned channel after input is fully consumed or on error.
+// If ctx is canceled, it stops early and returns.
+func ScanErrCtx[A, B any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	init B,
+	f func(context.Context, B, A) (B, error),
+	opts ...Option,
+) <-chan B {
+	cfg := makeConfig(opts)
+	out, ret := makeOut[B](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "scan", ret, in)
+	defer st.launched()
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+		acc := init
+
+		for {
+			pr.set(StageReading)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case a, ok := <-in:
+				if !ok {
+					return nil
+				}
+				pr.receive()
+
+				var err error
+				acc, err = f(ctx, acc, a)
+				if err != nil {
+					return err
+				}
+
+				pr.set(StageSending)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case out <- acc:
+					st.emit(len(out))
+				}
+			}
+		}
+	})
+
+	return ret
+}
@@ -87,3 +87,28 @@ func ExampleFoldErrCtx() {
 	// Output:
 	// 15
 }
+
+func ExampleScan() {
+	p, ctx := chankit.NewPipeline(context.Background())
+
+	// emits running sum
+	sum := func(acc, i int) int { return acc + i }
+
+	in := slice2chan([]int{1, 2, 3, 4, 5})
+	out := chankit.Scan(ctx, p, in, 0, sum)
+
+	for v := range out {
+		fmt.Println(v)
+	}
+
+	if err := p.Wait(); err != nil {
+		panic(err)
+	}
+
+	// Output:
+	// 1
+	// 3
+	// 6
+	// 10
+	// 15
+}
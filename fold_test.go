@@ -95,3 +95,75 @@ func TestFoldErrCtx(t *testing.T) {
 		}
 	})
 }
+
+func TestScan(t *testing.T) {
+	tests := []struct {
+		name   string
+		bufCap int
+		input  []int
+		want   []int
+	}{
+		{"empty input", 0, nil, nil},
+		{"running sum", 0, []int{0, 1, 2, 3, 4, 5}, []int{0, 1, 3, 6, 10, 15}},
+		{"running sum buffered", 4, []int{1, 1, 1, 1}, []int{1, 2, 3, 4}},
+	}
+
+	agg := func(acc, i int) int { return acc + i }
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, ctx := NewPipeline(t.Context())
+			out := Scan(ctx, p, slice2chan(tc.input), 0, agg, WithBuffer(tc.bufCap))
+			got := chan2slice(out)
+
+			assertNoPipeError(t, p)
+			assertSlicesEqual(t, tc.want, got)
+		})
+	}
+}
+
+func TestScanErr(t *testing.T) {
+	t.Run("error propagation", func(t *testing.T) {
+		t.Parallel()
+
+		f := func(acc, v int) (int, error) {
+			if v < 0 {
+				return 0, errors.New("negative input")
+			}
+			return acc + v, nil
+		}
+
+		p, ctx := NewPipeline(t.Context())
+		in := slice2chan([]int{1, 2, -1, 4})
+		got := chan2slice(ScanErr(ctx, p, in, 0, f))
+
+		if err := p.Wait(); err == nil {
+			t.Fatal("error expected")
+		}
+		assertSlicesEqual(t, []int{1, 3}, got)
+	})
+
+	t.Run("infinite input", func(t *testing.T) {
+		t.Parallel()
+
+		prodCtx, prodCancel := context.WithCancel(t.Context())
+		defer prodCancel()
+
+		p, ctx := NewPipeline(t.Context())
+		out := ScanErrCtx(
+			ctx,
+			p,
+			CreateProducer(prodCtx),
+			0,
+			func(_ context.Context, acc, v int) (int, error) { return acc + v, nil },
+		)
+
+		got := chan2slice(Take(ctx, p, out, 5))
+		prodCancel()
+
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, []int{0, 1, 3, 6, 10}, got)
+	})
+}
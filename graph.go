@@ -0,0 +1,162 @@
+package chankit
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Graph is a snapshot of the topology of a pipeline, see Pipeline.Graph.
+type Graph struct {
+	Nodes []GraphNode
+	Edges []GraphEdge
+}
+
+// GraphNode is a stage of a Graph.
+//
+// Channels read by stages but not written by any registered stage, e.g.
+// sources, are represented by nodes of kind "input".
+type GraphNode struct {
+	StageInfo
+	Parallelism int // current number of workers
+	BufferSize  int // capacity of the output buffer, see WithBuffer
+	Stats       StageStats
+}
+
+// StageStats holds the live counters of a stage.
+type StageStats struct {
+	Received int64 // elements read from the inputs
+	Emitted  int64 // elements sent downstream
+	Running  bool  // some goroutines of the stage have not returned yet
+	Err      error // first error of the stage, if any
+}
+
+// GraphEdge is a channel from the stage named From to the stage named To.
+type GraphEdge struct {
+	From, To string
+}
+
+// Graph returns a snapshot of the stages registered in the pipeline and of
+// the channels between them, with their live counters.
+//
+// Every stage registers itself when it is created.
+func (p *Pipeline) Graph() Graph {
+	stages := p.registered()
+
+	var g Graph
+	producers := make(map[uintptr]string, len(stages))
+	for _, st := range stages {
+		producers[chanID(st.out)] = st.info.Name
+		g.Nodes = append(g.Nodes, st.node())
+	}
+
+	inputs := 0
+	for _, st := range stages {
+		for _, in := range st.ins {
+			id := chanID(in)
+			if id == 0 {
+				continue // nil channel, e.g. a SkipUntil signal that never fires
+			}
+			from, ok := producers[id]
+			if !ok {
+				inputs++
+				from = "input-" + strconv.Itoa(inputs)
+				producers[id] = from
+				g.Nodes = append(g.Nodes, GraphNode{
+					StageInfo: StageInfo{
+						Pipeline:        p.name,
+						Kind:            "input",
+						Name:            from,
+						unnamedPipeline: p.unnamed,
+					},
+				})
+			}
+			g.Edges = append(g.Edges, GraphEdge{From: from, To: st.info.Name})
+		}
+	}
+	return g
+}
+
+func (s *stage) node() GraphNode {
+	s.mu.Lock()
+	parallel, err := s.parallel, s.err
+	s.mu.Unlock()
+
+	n := GraphNode{
+		StageInfo:   s.info,
+		Parallelism: 1,
+		BufferSize:  s.bufSize,
+		Stats: StageStats{
+			Received: s.received.Load(),
+			Emitted:  s.emitted.Load(),
+			Running:  s.running.Load() > 0,
+			Err:      err,
+		},
+	}
+	if parallel != nil {
+		n.Parallelism = parallel()
+	}
+	return n
+}
+
+// chanID identifies a channel regardless of its direction.
+func chanID(ch any) uintptr {
+	return reflect.ValueOf(ch).Pointer()
+}
+
+// DOT renders the graph in the Graphviz DOT language.
+func (g Graph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph {\n\trankdir=LR;\n")
+	for _, n := range g.Nodes {
+		shape := "box"
+		if n.Kind == "input" {
+			shape = "point"
+		}
+		fmt.Fprintf(&b, "\t%s [shape=%s, label=%s];\n",
+			strconv.Quote(n.Name), shape, strconv.Quote(n.label("\n")))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%s -> %s;\n", strconv.Quote(e.From), strconv.Quote(e.To))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid renders the graph as a Mermaid flowchart.
+func (g Graph) Mermaid() string {
+	ids := make(map[string]string, len(g.Nodes))
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	for i, n := range g.Nodes {
+		id := "n" + strconv.Itoa(i)
+		ids[n.Name] = id
+		if n.Kind == "input" {
+			fmt.Fprintf(&b, "\t%s(( ))\n", id)
+			continue
+		}
+		label := strings.ReplaceAll(n.label("<br/>"), `"`, "#quot;")
+		fmt.Fprintf(&b, "\t%s[\"%s\"]\n", id, label)
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(&b, "\t%s --> %s\n", ids[e.From], ids[e.To])
+	}
+	return b.String()
+}
+
+// label describes the node on lines separated by sep.
+func (n GraphNode) label(sep string) string {
+	if n.Kind == "input" {
+		return n.Name
+	}
+	label := fmt.Sprintf("%s (%s)%sin=%d out=%d",
+		n.Name, n.Kind, sep, n.Stats.Received, n.Stats.Emitted)
+	if n.Parallelism > 1 {
+		label += fmt.Sprintf(" par=%d", n.Parallelism)
+	}
+	if n.BufferSize > 0 {
+		label += fmt.Sprintf(" buf=%d", n.BufferSize)
+	}
+	return label
+}
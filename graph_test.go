@@ -0,0 +1,137 @@
+package chankit
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPipelineGraph(t *testing.T) {
+	t.Parallel()
+
+	p, ctx := NewPipeline(t.Context())
+
+	parsed := Map(
+		ctx,
+		p,
+		slice2chan(genInts(10)),
+		func(x int) int { return x },
+		WithName("parse"),
+		WithParallel(3),
+		WithBuffer(2),
+	)
+	kept := Filter(ctx, p, parsed, func(x int) bool { return x < 5 }, WithName("keep"))
+	dropped := Drop(ctx, p, slice2chan(genInts(3)), 1, WithName("skip"))
+	merged := Merge(ctx, p, kept, dropped, WithName("merge"))
+	sum := Fold(ctx, p, merged, 0, func(acc, x int) int { return acc + x }, WithName("sum"))
+
+	if got := <-sum; got != 0+1+2+3+4+1+2 {
+		t.Fatalf("unexpected sum %d", got)
+	}
+	assertNoPipeError(t, p)
+
+	g := p.Graph()
+
+	nodes := make(map[string]GraphNode)
+	for _, n := range g.Nodes {
+		nodes[n.Name] = n
+	}
+	if len(nodes) != 7 {
+		t.Fatalf("expected 5 stages and 2 inputs, got %+v", g.Nodes)
+	}
+	if n := nodes["parse"]; n.Parallelism != 3 || n.BufferSize != 2 || n.Stats.Emitted != 10 {
+		t.Fatalf("unexpected parse node %+v", n)
+	}
+	if n := nodes["keep"]; n.Stats.Received != 10 || n.Stats.Emitted != 5 || n.Stats.Running {
+		t.Fatalf("unexpected keep node %+v", n)
+	}
+
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, e.From+"->"+e.To)
+	}
+	slices.Sort(edges)
+	want := []string{
+		"input-1->parse",
+		"input-2->skip",
+		"keep->merge",
+		"merge->sum",
+		"parse->keep",
+		"skip->merge",
+	}
+	if !slices.Equal(want, edges) {
+		t.Fatalf("expected edges %v, got %v", want, edges)
+	}
+
+	dot := g.DOT()
+	for _, s := range []string{`"parse" -> "keep";`, `label="keep (filter)\nin=10 out=5"`} {
+		if !strings.Contains(dot, s) {
+			t.Fatalf("expected DOT to contain %s, got:\n%s", s, dot)
+		}
+	}
+
+	mermaid := g.Mermaid()
+	if !strings.HasPrefix(mermaid, "flowchart LR\n") ||
+		strings.Count(mermaid, "-->") != len(want) ||
+		!strings.Contains(mermaid, `["parse (map)<br/>in=10 out=10 par=3 buf=2"]`) {
+		t.Fatalf("unexpected Mermaid output:\n%s", mermaid)
+	}
+}
+
+func TestPipelineGraphMultiInput(t *testing.T) {
+	t.Parallel()
+
+	p, ctx := NewPipeline(t.Context())
+
+	left := Map(ctx, p, slice2chan(genInts(5)), func(x int) int { return x }, WithName("left"))
+	right := Scan(
+		ctx,
+		p,
+		slice2chan(genInts(5)),
+		0,
+		func(acc, x int) int { return acc + x },
+		WithName("running"),
+	)
+	zipped := Zip(ctx, p, left, right, WithName("zip"))
+	got := chan2slice(TakeWhile(
+		ctx,
+		p,
+		zipped,
+		func(Pair[int, int]) bool { return true },
+		WithName("while"),
+	))
+
+	assertNoPipeError(t, p)
+	if len(got) != 5 {
+		t.Fatalf("expected 5 pairs, got %v", got)
+	}
+
+	g := p.Graph()
+
+	nodes := make(map[string]GraphNode)
+	for _, n := range g.Nodes {
+		nodes[n.Name] = n
+	}
+	if len(nodes) != 6 {
+		t.Fatalf("expected 4 stages and 2 inputs, got %+v", g.Nodes)
+	}
+	if n := nodes["zip"]; n.Kind != "zip" || n.Stats.Received != 10 || n.Stats.Emitted != 5 {
+		t.Fatalf("unexpected zip node %+v", n)
+	}
+
+	var edges []string
+	for _, e := range g.Edges {
+		edges = append(edges, e.From+"->"+e.To)
+	}
+	slices.Sort(edges)
+	want := []string{
+		"input-1->left",
+		"input-2->running",
+		"left->zip",
+		"running->zip",
+		"zip->while",
+	}
+	if !slices.Equal(want, edges) {
+		t.Fatalf("expected edges %v, got %v", want, edges)
+	}
+}
@@ -0,0 +1,228 @@
+package chankit
+
+import (
+	"container/list"
+	"context"
+	"time"
+)
+
+// KeyedResult is an accumulator emitted by FoldByKeyStream.
+type KeyedResult[K comparable, B any] struct {
+	Key K
+	Acc B
+	// Final reports whether the key was dropped from the stage state after
+	// this result was emitted (idle, evicted or input closed).
+	Final bool
+}
+
+// FoldByKey reduces elements from `in` into one accumulator per key using `f`.
+//
+// Every key starts from `init`. When the input channel closes without error,
+// the map of accumulators is sent and the returned channel is closed.
+// If ctx is canceled, it stops early and returns.
+func FoldByKey[A any, K comparable, B any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	keyFn func(A) K,
+	init B,
+	f func(B, A) B,
+) <-chan map[K]B {
+	return Fold(ctx, p, in, make(map[K]B), func(accs map[K]B, a A) map[K]B {
+		k := keyFn(a)
+		acc, ok := accs[k]
+		if !ok {
+			acc = init
+		}
+		accs[k] = f(acc, a)
+		return accs
+	})
+}
+
+// ReduceByKey reduces elements from `in` into one value per key using `f`.
+//
+// The first element seen for a key becomes its initial value. When the input
+// channel closes without error, the map of values is sent and the returned
+// channel is closed.
+// If ctx is canceled, it stops early and returns.
+func ReduceByKey[A any, K comparable](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	keyFn func(A) K,
+	f func(A, A) A,
+) <-chan map[K]A {
+	return Fold(ctx, p, in, make(map[K]A), func(accs map[K]A, a A) map[K]A {
+		k := keyFn(a)
+		if acc, ok := accs[k]; ok {
+			accs[k] = f(acc, a)
+		} else {
+			accs[k] = a
+		}
+		return accs
+	})
+}
+
+// FoldByKeyStream reduces elements from `in` into one accumulator per key
+// using `f` and emits the accumulators while the input is still running.
+//
+// Every key starts from `init`. Results are emitted:
+//
+//   - every WithFlushInterval, for all live keys (Final is false);
+//   - when a key was not updated for WithKeyIdle (Final is true);
+//   - when WithMaxKeys is exceeded, for the least recently updated key
+//     (Final is true);
+//   - when the input closes, for all remaining keys (Final is true).
+//
+// The WithEvictFunc callback is invoked for idle and evicted keys.
+// It closes the returned channel after input is fully consumed.
+// If ctx is canceled, it stops early and returns.
+func FoldByKeyStream[A any, K comparable, B any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	keyFn func(A) K,
+	init B,
+	f func(B, A) B,
+	opts ...Option,
+) <-chan KeyedResult[K, B] {
+	cfg := makeConfig(opts)
+	var onEvict func(K, B)
+	if cfg.keyed.onEvict != nil {
+		fn, ok := cfg.keyed.onEvict.(func(K, B))
+		if !ok {
+			panic("FoldByKeyStream: evict func does not match key and accumulator types")
+		}
+		onEvict = fn
+	}
+
+	out, ret := makeOut[KeyedResult[K, B]](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "fold-by-key", ret, in)
+	defer st.launched()
+
+	type entry struct {
+		key  K
+		acc  B
+		seen time.Time
+	}
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		clock := cfg.clock
+		idle := cfg.keyed.idle
+
+		// ordered from least to most recently updated
+		lru := list.New()
+		index := make(map[K]*list.Element)
+
+		var flushC <-chan time.Time
+		if cfg.keyed.flushEvery > 0 {
+			ticker := clock.NewTicker(cfg.keyed.flushEvery)
+			defer ticker.Stop()
+			flushC = ticker.C()
+		}
+
+		var idleT Timer
+		var idleC <-chan time.Time
+		armIdle := func() {
+			if idle <= 0 || idleC != nil || lru.Len() == 0 {
+				return
+			}
+			oldest := lru.Front().Value.(*entry)
+			d := oldest.seen.Add(idle).Sub(clock.Now())
+			if idleT == nil {
+				idleT = clock.NewTimer(d)
+			} else {
+				idleT.Reset(d)
+			}
+			idleC = idleT.C()
+		}
+		defer func() {
+			if idleT != nil {
+				idleT.Stop()
+			}
+		}()
+
+		send := func(r KeyedResult[K, B]) error {
+			pr.set(StageSending)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case out <- r:
+				st.emit(len(out))
+				return nil
+			}
+		}
+
+		evict := func(el *list.Element) error {
+			e := lru.Remove(el).(*entry)
+			delete(index, e.key)
+			if onEvict != nil {
+				onEvict(e.key, e.acc)
+			}
+			return send(KeyedResult[K, B]{Key: e.key, Acc: e.acc, Final: true})
+		}
+
+		for {
+			pr.set(StageReading)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-flushC:
+				for el := lru.Front(); el != nil; el = el.Next() {
+					e := el.Value.(*entry)
+					if err := send(KeyedResult[K, B]{Key: e.key, Acc: e.acc}); err != nil {
+						return err
+					}
+				}
+			case <-idleC:
+				idleC = nil
+				now := clock.Now()
+				for lru.Len() > 0 {
+					el := lru.Front()
+					if now.Sub(el.Value.(*entry).seen) < idle {
+						break
+					}
+					if err := evict(el); err != nil {
+						return err
+					}
+				}
+				armIdle()
+			case a, ok := <-in:
+				if !ok {
+					for lru.Len() > 0 {
+						e := lru.Remove(lru.Front()).(*entry)
+						err := send(KeyedResult[K, B]{Key: e.key, Acc: e.acc, Final: true})
+						if err != nil {
+							return err
+						}
+					}
+					return nil
+				}
+				pr.receive()
+
+				k := keyFn(a)
+				now := clock.Now()
+				if el, ok := index[k]; ok {
+					e := el.Value.(*entry)
+					e.acc = f(e.acc, a)
+					e.seen = now
+					lru.MoveToBack(el)
+				} else {
+					if cfg.keyed.maxKeys > 0 && lru.Len() >= cfg.keyed.maxKeys {
+						if err := evict(lru.Front()); err != nil {
+							return err
+						}
+					}
+					index[k] = lru.PushBack(&entry{key: k, acc: f(init, a), seen: now})
+				}
+				armIdle()
+			}
+		}
+	})
+
+	return ret
+}
@@ -0,0 +1,187 @@
+package chankit
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+)
+
+type event struct {
+	key string
+	val int
+}
+
+func TestFoldByKey(t *testing.T) {
+	t.Parallel()
+
+	in := []event{{"a", 1}, {"b", 2}, {"a", 3}, {"c", 4}, {"b", 5}}
+
+	p, ctx := NewPipeline(t.Context())
+	out := FoldByKey(
+		ctx,
+		p,
+		slice2chan(in),
+		func(e event) string { return e.key },
+		0,
+		func(cnt int, _ event) int { return cnt + 1 },
+	)
+	got := <-out
+
+	assertNoPipeError(t, p)
+	want := map[string]int{"a": 2, "b": 2, "c": 1}
+	if !maps.Equal(want, got) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestReduceByKey(t *testing.T) {
+	t.Parallel()
+
+	in := []event{{"a", 1}, {"b", 7}, {"a", 3}, {"b", 5}}
+
+	p, ctx := NewPipeline(t.Context())
+	out := ReduceByKey(
+		ctx,
+		p,
+		slice2chan(in),
+		func(e event) string { return e.key },
+		func(x, y event) event { return event{x.key, max(x.val, y.val)} },
+	)
+	got := <-out
+
+	assertNoPipeError(t, p)
+	want := map[string]event{"a": {"a", 3}, "b": {"b", 7}}
+	if !maps.Equal(want, got) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestFoldByKeyStream(t *testing.T) {
+	keyFn := func(e event) string { return e.key }
+	sum := func(acc int, e event) int { return acc + e.val }
+
+	t.Run("flush on close", func(t *testing.T) {
+		t.Parallel()
+
+		in := []event{{"a", 1}, {"b", 2}, {"a", 3}}
+
+		p, ctx := NewPipeline(t.Context())
+		got := chan2slice(FoldByKeyStream(ctx, p, slice2chan(in), keyFn, 0, sum))
+
+		assertNoPipeError(t, p)
+		want := []KeyedResult[string, int]{{"b", 2, true}, {"a", 4, true}}
+		if !slices.Equal(want, got) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("max keys", func(t *testing.T) {
+		t.Parallel()
+
+		in := []event{{"a", 1}, {"b", 2}, {"a", 3}, {"c", 4}}
+
+		var evicted []string
+		onEvict := func(k string, _ int) { evicted = append(evicted, k) }
+
+		p, ctx := NewPipeline(t.Context())
+		got := chan2slice(FoldByKeyStream(
+			ctx,
+			p,
+			slice2chan(in),
+			keyFn,
+			0,
+			sum,
+			WithMaxKeys(2),
+			WithEvictFunc(onEvict),
+		))
+
+		assertNoPipeError(t, p)
+		want := []KeyedResult[string, int]{{"b", 2, true}, {"a", 4, true}, {"c", 4, true}}
+		if !slices.Equal(want, got) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+		assertSlicesEqual(t, []string{"b"}, evicted)
+	})
+
+	t.Run("idle key", func(t *testing.T) {
+		t.Parallel()
+
+		clock := newFakeClock()
+		idle := 10 * time.Second
+		in := make(chan event)
+
+		p, ctx := NewPipeline(t.Context())
+		out := FoldByKeyStream(ctx, p, in, keyFn, 0, sum, WithKeyIdle(idle), WithClock(clock))
+
+		in <- event{"a", 1}
+		in <- event{"a", 2}
+
+		// a step shorter than idle keeps both elements in the same key state
+		r, _ := recvAdvancing(t, clock, idle/4, out)
+		if r != (KeyedResult[string, int]{"a", 3, true}) {
+			t.Fatalf("unexpected result %v", r)
+		}
+
+		close(in)
+		if rest := chan2slice(out); len(rest) != 0 {
+			t.Fatalf("expected no more results, got %v", rest)
+		}
+		assertNoPipeError(t, p)
+	})
+
+	t.Run("periodic flush", func(t *testing.T) {
+		t.Parallel()
+
+		clock := newFakeClock()
+		in := make(chan event)
+
+		p, ctx := NewPipeline(t.Context())
+		out := FoldByKeyStream(
+			ctx,
+			p,
+			in,
+			keyFn,
+			0,
+			sum,
+			WithFlushInterval(10*time.Second),
+			WithClock(clock),
+		)
+
+		in <- event{"a", 1}
+
+		r, _ := recvAdvancing(t, clock, 10*time.Second, out)
+		if r != (KeyedResult[string, int]{"a", 1, false}) {
+			t.Fatalf("unexpected result %v", r)
+		}
+
+		close(in)
+		for range out {
+		}
+		assertNoPipeError(t, p)
+	})
+
+	t.Run("mismatched evict func", func(t *testing.T) {
+		t.Parallel()
+
+		p, ctx := NewPipeline(t.Context())
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic expected")
+			}
+			if n := len(p.registered()); n != 0 {
+				t.Fatalf("expected no stage, got %d", n)
+			}
+		}()
+
+		_ = FoldByKeyStream(
+			ctx,
+			p,
+			make(chan event),
+			keyFn,
+			0,
+			sum,
+			WithEvictFunc(func(int, int) {}),
+		)
+	})
+}
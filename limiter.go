@@ -0,0 +1,159 @@
+package chankit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// Limiter caps the number of concurrent calls of user functions across all
+// the stages, possibly of different pipelines, it is attached to with
+// WithConcurrencyLimiter.
+//
+// Calls take one unit of capacity by default, or a per-element weight set
+// with WithLimiterWeight. Waiters are served in FIFO order, so heavy
+// elements are not starved by light ones.
+type Limiter struct {
+	size int64
+
+	mu      sync.Mutex
+	cur     int64
+	waiters list.List // of limiterWaiter
+}
+
+type limiterWaiter struct {
+	n     int64
+	ready chan struct{} // closed when the units are granted
+}
+
+// NewLimiter returns a Limiter with the given capacity.
+func NewLimiter(capacity int64) *Limiter {
+	if capacity <= 0 {
+		panic("NewLimiter: capacity must be > 0")
+	}
+	return &Limiter{size: capacity}
+}
+
+// Acquire takes n units, blocking until they are available or ctx is done.
+// A weight above the capacity takes the whole capacity.
+func (l *Limiter) Acquire(ctx context.Context, n int64) error {
+	n = l.clamp(n)
+
+	l.mu.Lock()
+	if l.size-l.cur >= n && l.waiters.Len() == 0 {
+		l.cur += n
+		l.mu.Unlock()
+		return nil
+	}
+
+	ready := make(chan struct{})
+	elem := l.waiters.PushBack(limiterWaiter{n: n, ready: ready})
+	l.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		select {
+		case <-ready:
+			// granted while cancelling: give the units back
+			l.cur -= n
+			l.notifyLocked()
+		default:
+			isFront := l.waiters.Front() == elem
+			l.waiters.Remove(elem)
+			if isFront {
+				l.notifyLocked()
+			}
+		}
+		return ctx.Err()
+	}
+}
+
+// TryAcquire takes n units if they are available right away.
+func (l *Limiter) TryAcquire(n int64) bool {
+	n = l.clamp(n)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.size-l.cur >= n && l.waiters.Len() == 0 {
+		l.cur += n
+		return true
+	}
+	return false
+}
+
+// Release gives back n units taken with Acquire or TryAcquire.
+func (l *Limiter) Release(n int64) {
+	n = l.clamp(n)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cur -= n
+	if l.cur < 0 {
+		panic("Limiter: released more than held")
+	}
+	l.notifyLocked()
+}
+
+// InUse returns the number of units currently taken.
+func (l *Limiter) InUse() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cur
+}
+
+func (l *Limiter) clamp(n int64) int64 {
+	return min(max(n, 0), l.size)
+}
+
+func (l *Limiter) notifyLocked() {
+	for {
+		front := l.waiters.Front()
+		if front == nil {
+			return
+		}
+		w := front.Value.(limiterWaiter)
+		if l.size-l.cur < w.n {
+			return // FIFO: do not let smaller waiters overtake
+		}
+		l.cur += w.n
+		l.waiters.Remove(front)
+		close(w.ready)
+	}
+}
+
+// withLimiter makes every call of fn hold units of l while it runs.
+func withLimiter[A, B any](
+	fn func(context.Context, A) (B, error),
+	l *Limiter,
+	weightFn func(A) int64,
+) func(context.Context, A) (B, error) {
+	return func(ctx context.Context, a A) (B, error) {
+		n := int64(1)
+		if weightFn != nil {
+			n = weightFn(a)
+		}
+		if err := l.Acquire(ctx, n); err != nil {
+			var zero B
+			return zero, err
+		}
+		defer l.Release(n)
+		return fn(ctx, a)
+	}
+}
+
+// limitedFunc applies the WithConcurrencyLimiter limiter of a stage reading
+// elements of type A to fn, if any.
+func limitedFunc[A, B any](
+	cfg *config,
+	fn func(context.Context, A) (B, error),
+) func(context.Context, A) (B, error) {
+	if cfg.limiter == nil {
+		return fn
+	}
+	weightFn, _ := cfg.limiterWeight.(func(A) int64)
+	return withLimiter(fn, cfg.limiter, weightFn)
+}
@@ -0,0 +1,147 @@
+package chankit
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	t.Run("fifo", func(t *testing.T) {
+		t.Parallel()
+
+		l := NewLimiter(3)
+		ctx := t.Context()
+
+		if err := l.Acquire(ctx, 2); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		heavy := make(chan struct{})
+		go func() {
+			_ = l.Acquire(ctx, 3)
+			close(heavy)
+		}()
+		for waiting := false; !waiting; {
+			time.Sleep(time.Millisecond)
+			l.mu.Lock()
+			waiting = l.waiters.Len() > 0
+			l.mu.Unlock()
+		}
+
+		if l.TryAcquire(1) {
+			t.Fatal("light acquire must not overtake a waiting heavy one")
+		}
+
+		l.Release(2)
+		select {
+		case <-heavy:
+		case <-time.After(500 * time.Millisecond):
+			t.Fatal("release must admit the waiting acquire")
+		}
+		if n := l.InUse(); n != 3 {
+			t.Fatalf("expected 3 units in use, got %d", n)
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		t.Parallel()
+
+		l := NewLimiter(1)
+		if !l.TryAcquire(1) {
+			t.Fatal("expected acquire to succeed")
+		}
+
+		ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+		defer cancel()
+		if err := l.Acquire(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline error, got %v", err)
+		}
+
+		l.Release(1)
+		if n := l.InUse(); n != 0 {
+			t.Fatalf("expected no units in use, got %d", n)
+		}
+		if !l.TryAcquire(5) {
+			t.Fatal("weight above capacity must take the whole capacity")
+		}
+	})
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	t.Parallel()
+
+	const capacity = 3
+	l := NewLimiter(capacity)
+
+	var cur, peak atomic.Int64
+	work := func(int) int {
+		n := cur.Add(1)
+		for {
+			m := peak.Load()
+			if n <= m || peak.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		cur.Add(-1)
+		return 0
+	}
+	run := func() <-chan int {
+		p, ctx := NewPipeline(t.Context())
+		out := Map(
+			ctx,
+			p,
+			slice2chan(genInts(50)),
+			work,
+			WithParallel(4),
+			WithConcurrencyLimiter(l),
+		)
+		go func() {
+			if err := p.Wait(); err != nil {
+				t.Errorf("unexpected pipeline error: %v", err)
+			}
+		}()
+		return out
+	}
+
+	// two pipelines sharing one limiter
+	a, b := run(), run()
+	if got := len(chan2slice(a)) + len(chan2slice(b)); got != 100 {
+		t.Fatalf("expected 100 elements, got %d", got)
+	}
+	if n := peak.Load(); n > capacity {
+		t.Fatalf("expected at most %d concurrent calls, got %d", capacity, n)
+	}
+}
+
+func TestLimiterWeight(t *testing.T) {
+	t.Parallel()
+
+	l := NewLimiter(4)
+
+	var cur, peak atomic.Int64
+	p, ctx := NewPipeline(t.Context())
+	out := Filter(ctx, p, slice2chan(genInts(20)), func(int) bool {
+		n := cur.Add(1)
+		if n > peak.Load() {
+			peak.Store(n)
+		}
+		time.Sleep(time.Millisecond)
+		cur.Add(-1)
+		return true
+	}, WithConcurrencyLimiter(l), WithLimiterWeight(func(int) int64 { return 4 }))
+
+	if got := chan2slice(out); len(got) != 20 {
+		t.Fatalf("expected 20 elements, got %d", len(got))
+	}
+	assertNoPipeError(t, p)
+	if n := l.InUse(); n != 0 {
+		t.Fatalf("expected all units released, got %d", n)
+	}
+	if n := peak.Load(); n != 1 {
+		t.Fatalf("expected calls to run one at a time, got %d", n)
+	}
+}
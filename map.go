@@ -2,7 +2,9 @@ package chankit
 
 import (
 	"context"
-	"sync"
+	"fmt"
+	"sync/atomic"
+	"time"
 )
 
 func Map[A, B any](
@@ -48,24 +50,96 @@ func mapImpl[A, B any](
 	opts ...Option,
 ) <-chan B {
 	cfg := makeConfig(opts)
-	out := make(chan B, cfg.bufCap)
+	var onErr func(A, error)
+	if cfg.deadLetter != nil {
+		fn, ok := cfg.deadLetter.(func(A, error))
+		if !ok {
+			panic("Map: dead letter func does not match input type")
+		}
+		onErr = fn
+	}
+
+	out, ret := makeOut[B](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "map", ret, in)
+	defer st.launched()
+
+	if cfg.elemTimeout > 0 {
+		fn = withElementTimeout(fn, cfg.elemTimeout)
+	}
+	fn = observedFunc(st.obs, tracedFunc(p.stageTracer(cfg), st.info, fn))
+
+	ctrl := cfg.parOpt.ctrl
+	parN := ctrl.initial(cfg.parOpt.n)
+
+	var gate *workerGate
+	if cfg.parOpt.adaptive {
+		gate = newWorkerGate(cfg.parOpt.minN)
+		limiter := newAIMDLimiter(gate, cfg.parOpt.minN, cfg.parOpt.n)
+		fn = withAdaptiveLimit(fn, limiter, cfg.clock)
+	}
+	fn = limitedFunc(cfg, fn)
+	if cfg.breaker != nil {
+		fn = withCircuitBreaker(fn, newCircuitBreaker(*cfg.breaker, cfg.clock), st.obs)
+	}
+	if onErr != nil {
+		fn = withDeadLetter(fn, onErr)
+	}
+
+	switch {
+	case gate != nil:
+		st.setParallel(gate.getLimit)
+	case ctrl != nil:
+		st.setParallel(ctrl.Parallel)
+	default:
+		st.setParallel(func() int { return max(parN, 1) })
+	}
 
 	switch {
-	case cfg.parOpt.n < 0:
+	case parN < 0:
 		panic("parallelism < 0")
-	case cfg.parOpt.n == 0:
-		sequentialMapImpl(ctx, p, in, out, fn)
-	case cfg.parOpt.n == 1:
-		concUnorderedMapImpl(ctx, p, in, out, fn, 1)
+	case parN == 0:
+		sequentialMapImpl(ctx, p, in, out, fn, st)
+	case parN == 1 && ctrl == nil:
+		concUnorderedMapImpl(ctx, p, in, out, fn, 1, gate, nil, st)
 	default:
 		if cfg.parOpt.unordered {
-			concUnorderedMapImpl(ctx, p, in, out, fn, cfg.parOpt.n)
+			concUnorderedMapImpl(ctx, p, in, out, fn, parN, gate, ctrl, st)
 		} else {
-			concOrderedMapImpl(ctx, p, in, out, fn, &cfg.parOpt)
+			concOrderedMapImpl(
+				ctx,
+				p,
+				in,
+				out,
+				fn,
+				parN,
+				&cfg.parOpt,
+				gate,
+				ctrl,
+				sizeFunc[B](cfg),
+				st,
+			)
 		}
 	}
 
-	return out
+	return ret
+}
+
+// withElementTimeout bounds every call of fn by its own deadline. fn must
+// honor its context for the deadline to take effect.
+func withElementTimeout[A, B any](
+	fn func(context.Context, A) (B, error),
+	d time.Duration,
+) func(context.Context, A) (B, error) {
+	return func(ctx context.Context, a A) (B, error) {
+		elemCtx, cancel := context.WithTimeoutCause(ctx, d, ErrElementTimeout)
+		defer cancel()
+
+		b, err := fn(elemCtx, a)
+		if err != nil && ctx.Err() == nil && context.Cause(elemCtx) == ErrElementTimeout {
+			return b, fmt.Errorf("%w: %w", ErrElementTimeout, err)
+		}
+		return b, err
+	}
 }
 
 func sequentialMapImpl[A, B any](
@@ -74,11 +148,15 @@ func sequentialMapImpl[A, B any](
 	in <-chan A,
 	out chan<- B,
 	fn func(context.Context, A) (B, error),
+	st *stage,
 ) {
-	p.goSafe(func() error {
+	p.goSafe(ctx, func() error {
 		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
 
 		for {
+			pr.set(StageReading)
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
@@ -86,16 +164,22 @@ func sequentialMapImpl[A, B any](
 				if !ok {
 					return nil
 				}
+				pr.receive()
 
 				b, err := fn(ctx, a)
+				if err == errSkip {
+					continue
+				}
 				if err != nil {
 					return err
 				}
 
+				pr.set(StageSending)
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
 				case out <- b:
+					st.emit(len(out))
 				}
 			}
 		}
@@ -109,42 +193,57 @@ func concUnorderedMapImpl[A, B any](
 	out chan<- B,
 	fn func(context.Context, A) (B, error),
 	parN int,
+	gate *workerGate,
+	ctrl *ParallelControl,
+	st *stage,
 ) {
-	var wg sync.WaitGroup
-	for range parN {
-		wg.Add(1)
-		p.goSafe(func() error {
-			defer wg.Done()
+	work := func(retire func() bool) error {
+		pr := st.probe()
+		defer pr.stop()
 
-			for {
+		for {
+			if retire() {
+				return nil
+			}
+			pr.set(StageReading)
+			if err := gate.acquire(ctx); err != nil {
+				return err
+			}
+
+			select {
+			case <-ctx.Done():
+				gate.release()
+				return ctx.Err()
+			case a, ok := <-in:
+				if !ok {
+					gate.release()
+					return nil
+				}
+				pr.receive()
+
+				b, err := fn(ctx, a)
+				gate.release()
+				if err == errSkip {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+
+				pr.set(StageSending)
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
-				case a, ok := <-in:
-					if !ok {
-						return nil
-					}
-
-					b, err := fn(ctx, a)
-					if err != nil {
-						return err
-					}
-
-					select {
-					case <-ctx.Done():
-						return ctx.Err()
-					case out <- b:
-					}
+				case out <- b:
+					st.emit(len(out))
 				}
 			}
-		})
+		}
 	}
 
-	p.goSafe(func() error {
-		wg.Wait()
-		close(out)
-		return nil
-	})
+	pool := &workerPool{onDone: func() { close(out) }}
+	pool.resize(ctx, p, parN, work)
+	ctrl.attach(parN, func(n int) { pool.resize(ctx, p, n, work) })
 }
 
 func concOrderedMapImpl[A, B any](
@@ -153,7 +252,12 @@ func concOrderedMapImpl[A, B any](
 	in <-chan A,
 	out chan<- B,
 	fn func(context.Context, A) (B, error),
+	parN int,
 	parOpt *parOpt,
+	gate *workerGate,
+	ctrl *ParallelControl,
+	sizeFn func(B) int,
+	st *stage,
 ) {
 	type job struct {
 		idx int64
@@ -161,22 +265,39 @@ func concOrderedMapImpl[A, B any](
 	}
 
 	type res struct {
-		idx int64
-		val B
+		idx  int64
+		val  B
+		size int64
+		skip bool // the element was dead-lettered, only its slot is kept
+	}
+
+	// results waiting in the reorder buffer are accounted against the memory
+	// budget; the one at the head is always admitted so that it can be emitted
+	mem := p.mem
+	if sizeFn == nil {
+		mem = nil
 	}
+	var head atomic.Int64
 
-	parN := parOpt.n
-	semCap := parOpt.reorderWindow
-	if semCap <= 0 { // default
-		semCap = 4 * max(parOpt.n, 1)
+	// the window follows the parallelism unless it was set explicitly
+	fixedWindow := parOpt.reorderWindow > 0
+	windowFor := func(parN int) int {
+		if fixedWindow {
+			return parOpt.reorderWindow
+		}
+		return 4 * max(parN, 1)
 	}
-	sem := make(chan struct{}, semCap)
+	window := newWorkerGate(windowFor(parN))
 	jobCh := make(chan job, parN)
 	resCh := make(chan res, parN)
 
-	p.goSafe(func() error {
+	p.goSafe(ctx, func() error {
 		defer close(jobCh)
+		pr := st.probe()
+		defer pr.stop()
+
 		for idx := int64(0); ; idx++ {
+			pr.set(StageReading)
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
@@ -184,77 +305,117 @@ func concOrderedMapImpl[A, B any](
 				if !ok {
 					return nil
 				}
+				// handing it to the workers is internal to the stage, which
+				// counts as running rather than sending
+				pr.receive()
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
 				case jobCh <- job{idx, a}:
 				}
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				case sem <- struct{}{}: // blocks when gap >= window
+				// blocks when gap >= window
+				if err := window.acquire(ctx); err != nil {
+					return err
 				}
 			}
 		}
 	})
 
-	var wg sync.WaitGroup
-	for range parN {
-		wg.Add(1)
-		p.goSafe(func() error {
-			defer wg.Done()
-			for {
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				case job, ok := <-jobCh:
-					if !ok {
-						return nil
-					}
+	work := func(retire func() bool) error {
+		pr := st.probe()
+		defer pr.stop()
+
+		for {
+			if retire() {
+				return nil
+			}
+			pr.set(StageReading)
+			if err := gate.acquire(ctx); err != nil {
+				return err
+			}
 
-					b, err := fn(ctx, job.val)
-					if err != nil {
+			select {
+			case <-ctx.Done():
+				gate.release()
+				return ctx.Err()
+			case job, ok := <-jobCh:
+				if !ok {
+					gate.release()
+					return nil
+				}
+
+				pr.set(StageRunning)
+				b, err := fn(ctx, job.val)
+				gate.release()
+				skip := err == errSkip
+				if err != nil && !skip {
+					return err
+				}
+
+				// still running while handing it to the reorder buffer
+				var size int64
+				if mem != nil && !skip {
+					size = int64(sizeFn(b))
+					isHead := func() bool { return job.idx == head.Load() }
+					if err := mem.acquire(ctx, size, isHead); err != nil {
 						return err
 					}
+				}
 
-					select {
-					case <-ctx.Done():
-						return ctx.Err()
-					case resCh <- res{job.idx, b}:
-					}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case resCh <- res{job.idx, b, size, skip}:
 				}
 			}
-		})
+		}
 	}
 
-	p.goSafe(func() error {
-		wg.Wait()
-		close(resCh)
-		return nil
+	pool := &workerPool{onDone: func() { close(resCh) }}
+	pool.resize(ctx, p, parN, work)
+	ctrl.attach(parN, func(n int) {
+		pool.resize(ctx, p, n, work)
+		window.setLimit(windowFor(n))
 	})
 
-	p.goSafe(func() error {
+	p.goSafe(ctx, func() error {
 		next := int64(0)
-		buffer := make(map[int64]B, parN)
+		buffer := make(map[int64]res, parN)
+		pr := st.probe()
+		defer pr.stop()
 
 		defer close(out)
 		defer func() {
-			for k := range buffer {
+			for k, r := range buffer {
+				if mem != nil {
+					mem.release(r.size)
+				}
 				delete(buffer, k)
 			}
 		}()
 
-		emit := func(ctx context.Context, v B) error {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			case out <- v:
-				<-sem
-				return nil
+		// emit sends r downstream, unless it was dead-lettered, and frees its
+		// slot; waiters on the budget are notified of the new head either way
+		emit := func(ctx context.Context, r res) error {
+			if !r.skip {
+				pr.set(StageSending)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case out <- r.val:
+					st.emit(len(out))
+				}
+			}
+			window.release()
+			if mem != nil {
+				head.Store(r.idx + 1)
+				mem.release(r.size)
 			}
+			return nil
 		}
 
 		for {
+			pr.set(StageReading)
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
@@ -273,7 +434,7 @@ func concOrderedMapImpl[A, B any](
 					}
 				}
 				if res.idx == next {
-					if err := emit(ctx, res.val); err != nil {
+					if err := emit(ctx, res); err != nil {
 						return err
 					}
 					next++
@@ -289,7 +450,7 @@ func concOrderedMapImpl[A, B any](
 						next++
 					}
 				} else {
-					buffer[res.idx] = res.val
+					buffer[res.idx] = res
 				}
 			}
 		}
@@ -2,6 +2,7 @@ package chankit
 
 import (
 	"context"
+	"errors"
 	"math/rand"
 	"testing"
 	"time"
@@ -75,6 +76,59 @@ func FuzzMapTest(f *testing.F) {
 	})
 }
 
+func TestMapElementTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"sequential", nil},
+		{"concurrent ordered", []Option{WithParallel(4)}},
+		{"concurrent unordered", []Option{WithParallel(4), WithUnordered()}},
+	}
+
+	// blocks on 3 until its context is done
+	stuck := func(ctx context.Context, x int) (int, error) {
+		if x == 3 {
+			<-ctx.Done()
+			return 0, ctx.Err()
+		}
+		return x, nil
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, ctx := NewPipeline(t.Context())
+			opts := append(tc.opts, WithElementTimeout(10*time.Millisecond))
+			out := MapErrCtx(ctx, p, slice2chan(genInts(10)), stuck, opts...)
+			_ = chan2slice(out)
+
+			err := p.Wait()
+			if !errors.Is(err, ErrElementTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("expected element timeout, got %v", err)
+			}
+		})
+	}
+
+	t.Run("within deadline", func(t *testing.T) {
+		t.Parallel()
+
+		items := genInts(100)
+		p, ctx := NewPipeline(t.Context())
+		out := MapErrCtx(
+			ctx,
+			p,
+			slice2chan(items),
+			randWork(maxSleep, mul),
+			WithParallel(4),
+			WithElementTimeout(time.Second),
+		)
+		got := chan2slice(out)
+		check(t, p, items, got, true, mul)
+	})
+}
+
 func check(t *testing.T, p *Pipeline, items, got []int, ordered bool, mul int) {
 	t.Helper()
 
@@ -0,0 +1,177 @@
+package chankit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// memBudget is a pipeline-wide budget of bytes held in stage buffers.
+type memBudget struct {
+	limit int64
+
+	mu      sync.Mutex
+	used    int64
+	changed chan struct{} // closed and replaced whenever waiters may progress
+}
+
+func newMemBudget(limit int64) *memBudget {
+	return &memBudget{limit: limit, changed: make(chan struct{})}
+}
+
+// tryAcquire takes n bytes if they fit in the budget, or unconditionally when
+// force is set. A single element never takes more than the whole budget.
+// On failure, it returns a channel that is closed once retrying may succeed.
+func (m *memBudget) tryAcquire(n int64, force bool) (bool, <-chan struct{}) {
+	n = min(max(n, 0), m.limit)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if force || m.used+n <= m.limit {
+		m.used += n
+		return true, nil
+	}
+	return false, m.changed
+}
+
+// acquire is like tryAcquire, but waits until the bytes fit, force reports
+// true or ctx is done.
+func (m *memBudget) acquire(ctx context.Context, n int64, force func() bool) error {
+	for {
+		// the channel is taken before force is evaluated, so that a notify
+		// following a change of its result is never missed
+		m.mu.Lock()
+		changed := m.changed
+		m.mu.Unlock()
+
+		if ok, _ := m.tryAcquire(n, force()); ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (m *memBudget) release(n int64) {
+	n = min(max(n, 0), m.limit)
+
+	m.mu.Lock()
+	m.used -= n
+	m.mu.Unlock()
+	m.notify()
+}
+
+// notify wakes up waiters, e.g. when the condition passed as force changed.
+func (m *memBudget) notify() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+func (m *memBudget) inUse() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.used
+}
+
+// sizeFunc returns the WithSizeFunc function of a stage emitting elements of
+// type A, or nil if none was set for that type.
+func sizeFunc[A any](cfg *config) func(A) int {
+	fn, _ := cfg.sizeFn.(func(A) int)
+	return fn
+}
+
+// makeOut creates the output of a stage: the stage writes to the first
+// channel, and returns the second one to its consumer.
+//
+// Without a memory budget (see WithMemoryBudget) or size func, both are the
+// same channel buffered with WithBuffer. Otherwise, buffered elements are
+// held by a forwarder that accounts their bytes against the budget and stops
+// accepting new elements while it is exhausted. The number of elements it
+// holds is then reported as the queue depth of the stage (see Observer).
+func makeOut[A any](ctx context.Context, p *Pipeline, cfg *config) (chan A, <-chan A) {
+	sizeFn := sizeFunc[A](cfg)
+	if p.mem == nil || sizeFn == nil || cfg.bufCap == 0 {
+		out := make(chan A, cfg.bufCap)
+		return out, out
+	}
+
+	in := make(chan A)
+	out := make(chan A)
+
+	type sized struct {
+		val  A
+		size int64
+	}
+
+	var held atomic.Int64
+	cfg.queued = func() int { return int(held.Load()) }
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+
+		queue := make([]sized, 0, cfg.bufCap)
+		defer func() {
+			for _, s := range queue {
+				p.mem.release(s.size)
+			}
+		}()
+
+		var pending sized
+		var hasPending bool
+		var budgetC <-chan struct{}
+
+		for {
+			if hasPending {
+				// an empty queue always accepts an element, so the stage progresses
+				ok, changed := p.mem.tryAcquire(pending.size, len(queue) == 0)
+				if ok {
+					queue = append(queue, pending)
+					pending, hasPending, budgetC = sized{}, false, nil
+				} else {
+					budgetC = changed
+				}
+			}
+
+			if in == nil && !hasPending && len(queue) == 0 {
+				return nil
+			}
+
+			inC := in
+			if hasPending || len(queue) == cfg.bufCap {
+				inC = nil
+			}
+
+			var outC chan<- A
+			var next A
+			if len(queue) > 0 {
+				outC = out
+				next = queue[0].val
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-budgetC:
+			case a, ok := <-inC:
+				if !ok {
+					in = nil
+					continue
+				}
+				pending, hasPending = sized{a, int64(sizeFn(a))}, true
+				held.Add(1)
+			case outC <- next:
+				held.Add(-1)
+				p.mem.release(queue[0].size)
+				queue[0] = sized{}
+				queue = queue[1:]
+			}
+		}
+	})
+
+	return in, out
+}
@@ -0,0 +1,154 @@
+package chankit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemBudget(t *testing.T) {
+	t.Parallel()
+
+	m := newMemBudget(10)
+
+	if ok, _ := m.tryAcquire(6, false); !ok {
+		t.Fatal("expected acquire to succeed")
+	}
+	ok, changed := m.tryAcquire(6, false)
+	if ok {
+		t.Fatal("expected acquire to fail")
+	}
+	if ok, _ := m.tryAcquire(100, true); !ok {
+		t.Fatal("expected forced acquire to succeed")
+	}
+	if n := m.inUse(); n != 16 {
+		t.Fatalf("expected 16 bytes in use, got %d", n)
+	}
+
+	m.release(10)
+	select {
+	case <-changed:
+	default:
+		t.Fatal("expected waiters to be notified")
+	}
+	if ok, _ := m.tryAcquire(4, false); !ok {
+		t.Fatal("expected acquire to succeed")
+	}
+	if n := m.inUse(); n != 10 {
+		t.Fatalf("expected 10 bytes in use, got %d", n)
+	}
+}
+
+func TestMemBudgetAcquireWakeup(t *testing.T) {
+	t.Parallel()
+
+	m := newMemBudget(10)
+	m.tryAcquire(10, false)
+
+	// force turns true while it is evaluated, as when another goroutine
+	// advances the reorder head and notifies right before tryAcquire
+	var head bool
+	force := func() bool {
+		was := head
+		if !head {
+			head = true
+			m.notify()
+		}
+		return was
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+	if err := m.acquire(ctx, 4, force); err != nil {
+		t.Fatalf("expected acquire to be woken up, got %v", err)
+	}
+}
+
+// depthObserver records the largest queue depth reported.
+type depthObserver struct {
+	*countingObserver
+
+	mu       sync.Mutex
+	maxDepth int
+}
+
+func (o *depthObserver) QueueDepth(_ StageInfo, n int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.maxDepth = max(o.maxDepth, n)
+}
+
+func TestMemoryBudgetQueueDepth(t *testing.T) {
+	t.Parallel()
+
+	obs := &depthObserver{countingObserver: newCountingObserver()}
+	p, ctx := NewPipeline(t.Context(), WithMemoryBudget(100))
+	out := Map(
+		ctx,
+		p,
+		slice2chan(genInts(8)),
+		func(x int) int { return x },
+		WithBuffer(8),
+		WithSizeFunc(func(int) int { return 1 }),
+		WithObserver(obs),
+		WithName("map"),
+	)
+
+	// the forwarder holds every element until the output is read
+	for obs.snapshot()["map"].emitted < 8 {
+		time.Sleep(time.Millisecond)
+	}
+	got := chan2slice(out)
+
+	assertNoPipeError(t, p)
+	assertSlicesEqual(t, genInts(8), got)
+	obs.mu.Lock()
+	defer obs.mu.Unlock()
+	if obs.maxDepth < 1 {
+		t.Fatalf("expected buffered elements to be reported, got depth %d", obs.maxDepth)
+	}
+}
+
+func TestMemoryBudget(t *testing.T) {
+	const budget = 10
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"buffered", []Option{WithBuffer(100)}},
+		{"reorder window", []Option{WithParallel(8), WithReorderWindow(100)}},
+		{"reorder window buffered", []Option{WithParallel(8), WithBuffer(100)}},
+	}
+
+	work := randWork(maxSleep, 1)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			items := genInts(300)
+
+			p, ctx := NewPipeline(t.Context(), WithMemoryBudget(budget))
+			opts := append(tc.opts, WithSizeFunc(func(int) int { return 4 }))
+			out := MapErrCtx(ctx, p, slice2chan(items), work, opts...)
+
+			var got []int
+			for v := range out {
+				// a few forced elements may exceed the budget to guarantee progress
+				if n := p.mem.inUse(); n > budget+2*4 {
+					t.Fatalf("budget exceeded: %d bytes in use", n)
+				}
+				got = append(got, v)
+				time.Sleep(10 * time.Microsecond)
+			}
+
+			assertNoPipeError(t, p)
+			assertSlicesEqual(t, items, got)
+			if n := p.mem.inUse(); n != 0 {
+				t.Fatalf("expected budget to be released, %d bytes in use", n)
+			}
+		})
+	}
+}
@@ -16,63 +16,77 @@ func Merge[A any](
 	}
 
 	cfg := makeConfig(opts)
-	out := make(chan A, cfg.bufCap)
+	out, ret := makeOut[A](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "merge", ret, leftIn, rightIn)
+	defer st.launched()
 
-	var leftDone, rightDone bool
-
-	shouldStop := func() (bool, error) {
-		switch cfg.haltStrategy {
-		case HaltLeft:
-			return leftDone, nil
-		case HaltRight:
-			return rightDone, nil
-		case HaltEither:
-			return leftDone || rightDone, nil
-		case HaltBoth:
-			return leftDone && rightDone, nil
-		default:
-			return true, ErrUnknownHaltStrategy
-		}
-	}
-
-	p.goSafe(func() error {
+	p.goSafe(ctx, func() error {
 		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
 
-		for {
-			stop, err := shouldStop()
-			if err != nil {
-				return err
-			}
-			if stop {
-				return nil
-			}
+		send := func(a A) error {
+			st.receive()
+			pr.set(StageSending)
+			defer pr.set(StageReading)
 
 			select {
 			case <-ctx.Done():
 				return ctx.Err()
-			case la, ok := <-leftIn:
-				if !ok {
-					leftDone = true
-					leftIn = nil
-					continue
-				}
-				select {
-				case <-ctx.Done():
-				case out <- la:
-				}
-			case ra, ok := <-rightIn:
-				if !ok {
-					rightDone = true
-					rightIn = nil
-					continue
-				}
-				select {
-				case <-ctx.Done():
-				case out <- ra:
-				}
+			case out <- a:
+				st.emit(len(out))
+				return nil
 			}
 		}
+
+		return mergeLoop(ctx, cfg.haltStrategy, leftIn, rightIn, send, send)
 	})
 
-	return out
+	return ret
+}
+
+// mergeLoop reads from both inputs as elements become available, passing them
+// to onLeft and onRight, until the halt strategy stops it.
+func mergeLoop[A, B any](
+	ctx context.Context,
+	halt HaltStrategy,
+	leftIn <-chan A,
+	rightIn <-chan B,
+	onLeft func(A) error,
+	onRight func(B) error,
+) error {
+	var leftDone, rightDone bool
+
+	for {
+		stop, err := halt.halted(leftDone, rightDone)
+		if err != nil {
+			return err
+		}
+		if stop {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case la, ok := <-leftIn:
+			if !ok {
+				leftDone = true
+				leftIn = nil
+				continue
+			}
+			if err := onLeft(la); err != nil {
+				return err
+			}
+		case rb, ok := <-rightIn:
+			if !ok {
+				rightDone = true
+				rightIn = nil
+				continue
+			}
+			if err := onRight(rb); err != nil {
+				return err
+			}
+		}
+	}
 }
@@ -0,0 +1,181 @@
+package chankit
+
+import (
+	"expvar"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets are the upper bounds of the latency histogram buckets.
+var latencyBuckets = [...]time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// ExpvarObserver is an Observer publishing per-stage metrics with the
+// expvar package, e.g. served on /debug/vars by expvar.Handler.
+//
+// Metrics are published under a single expvar.Map, keyed by pipeline name
+// and then by stage name (see WithPipelineName and WithName):
+//
+//	{"orders": {"map-1": {"received": 10, "emitted": 10, "errors": 0,
+//	  "queue_depth": 0, "latency": {"count": 10, "sum_ns": 1234,
+//	  "buckets": {"100µs": 9, "1ms": 10, ..., "+Inf": 10}}}}}
+//
+// Histogram buckets are cumulative. Only pipelines named with
+// WithPipelineName are published, so that short-lived unnamed pipelines do
+// not accumulate entries; their events are ignored.
+type ExpvarObserver struct {
+	root *expvar.Map
+
+	stages sync.Map   // StageInfo -> *stageVars
+	mu     sync.Mutex // serializes the publication of new stages
+}
+
+// expvarMu serializes the lookup and publication of ExpvarObserver maps.
+var expvarMu sync.Mutex
+
+// NewExpvarObserver returns an ExpvarObserver publishing its metrics under
+// the given expvar name. If an expvar.Map is already published under that
+// name, e.g. by a previous observer, it is reused and the observers share
+// it. It panics if the name is used by another kind of expvar.Var.
+func NewExpvarObserver(name string) *ExpvarObserver {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	var root *expvar.Map
+	switch v := expvar.Get(name).(type) {
+	case nil:
+		root = expvar.NewMap(name)
+	case *expvar.Map:
+		root = v
+	default:
+		panic("NewExpvarObserver: " + name + " is not an expvar.Map")
+	}
+	return &ExpvarObserver{root: root}
+}
+
+func (o *ExpvarObserver) OnReceive(s StageInfo) {
+	if v := o.stage(s); v != nil {
+		v.received.Add(1)
+	}
+}
+
+func (o *ExpvarObserver) OnEmit(s StageInfo) {
+	if v := o.stage(s); v != nil {
+		v.emitted.Add(1)
+	}
+}
+
+func (o *ExpvarObserver) OnError(s StageInfo, _ error) {
+	if v := o.stage(s); v != nil {
+		v.errors.Add(1)
+	}
+}
+
+func (o *ExpvarObserver) OnFnLatency(s StageInfo, d time.Duration) {
+	if v := o.stage(s); v != nil {
+		v.observeLatency(d)
+	}
+}
+
+func (o *ExpvarObserver) QueueDepth(s StageInfo, n int) {
+	if v := o.stage(s); v != nil {
+		v.queueDepth.Store(int64(n))
+	}
+}
+
+// stage returns the metrics of s, publishing them on first use, or nil if
+// the pipeline of s is unnamed. Only the first use of a stage locks.
+func (o *ExpvarObserver) stage(s StageInfo) *stageVars {
+	if s.unnamedPipeline {
+		return nil
+	}
+	if v, ok := o.stages.Load(s); ok {
+		return v.(*stageVars)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if v, ok := o.stages.Load(s); ok {
+		return v.(*stageVars)
+	}
+
+	pipeline, ok := o.root.Get(s.Pipeline).(*expvar.Map)
+	if !ok {
+		pipeline = new(expvar.Map)
+		o.root.Set(s.Pipeline, pipeline)
+	}
+	v := &stageVars{}
+	pipeline.Set(s.Name, v)
+	o.stages.Store(s, v)
+	return v
+}
+
+// stageVars holds the metrics of a stage. It is an expvar.Var.
+type stageVars struct {
+	received   atomic.Int64
+	emitted    atomic.Int64
+	errors     atomic.Int64
+	queueDepth atomic.Int64
+
+	count   atomic.Int64
+	sumNs   atomic.Int64
+	buckets [len(latencyBuckets) + 1]atomic.Int64 // last one is +Inf
+}
+
+func (v *stageVars) observeLatency(d time.Duration) {
+	v.count.Add(1)
+	v.sumNs.Add(int64(d))
+	i := 0
+	for i < len(latencyBuckets) && d > latencyBuckets[i] {
+		i++
+	}
+	v.buckets[i].Add(1)
+}
+
+// String returns the metrics as JSON.
+func (v *stageVars) String() string {
+	var b strings.Builder
+	field := func(name string, n int64) {
+		b.WriteString(strconv.Quote(name))
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatInt(n, 10))
+	}
+
+	b.WriteByte('{')
+	field("received", v.received.Load())
+	b.WriteByte(',')
+	field("emitted", v.emitted.Load())
+	b.WriteByte(',')
+	field("errors", v.errors.Load())
+	b.WriteByte(',')
+	field("queue_depth", v.queueDepth.Load())
+	b.WriteString(`,"latency":{`)
+	field("count", v.count.Load())
+	b.WriteByte(',')
+	field("sum_ns", v.sumNs.Load())
+	b.WriteString(`,"buckets":{`)
+	var cum int64
+	for i := range v.buckets {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		cum += v.buckets[i].Load()
+		le := "+Inf"
+		if i < len(latencyBuckets) {
+			le = latencyBuckets[i].String()
+		}
+		field(le, cum)
+	}
+	b.WriteString("}}}")
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package chankit
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+// expvarSeq makes expvar names unique across runs of the same test binary,
+// e.g. with -count.
+var expvarSeq atomic.Int64
+
+func TestExpvarObserver(t *testing.T) {
+	t.Parallel()
+
+	name := "chankit_test_" + strconv.FormatInt(expvarSeq.Add(1), 10)
+	obs := NewExpvarObserver(name)
+	p, ctx := NewPipeline(t.Context(), WithPipelineName("orders"), WithPipelineObserver(obs))
+
+	mapped := Map(ctx, p, slice2chan(genInts(10)), func(x int) int { return x }, WithName("map"))
+	for range Filter(ctx, p, mapped, func(x int) bool { return x < 4 }, WithName("filter")) {
+	}
+	assertNoPipeError(t, p)
+
+	// unnamed pipelines are not published
+	p, ctx = NewPipeline(t.Context(), WithPipelineObserver(obs))
+	for range Map(ctx, p, slice2chan(genInts(10)), func(x int) int { return x }) {
+	}
+	assertNoPipeError(t, p)
+
+	// the map is reused by observers with the same name
+	if NewExpvarObserver(name).root != obs.root {
+		t.Fatal("expected the published map to be reused")
+	}
+
+	srv := httptest.NewServer(expvar.Handler())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/debug/vars")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	type stage struct {
+		Received int64 `json:"received"`
+		Emitted  int64 `json:"emitted"`
+		Errors   int64 `json:"errors"`
+		Latency  struct {
+			Count   int64            `json:"count"`
+			Buckets map[string]int64 `json:"buckets"`
+		} `json:"latency"`
+	}
+	var vars map[string]json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&vars); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var metrics map[string]map[string]stage
+	if err := json.Unmarshal(vars[name], &metrics); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(metrics) != 1 {
+		t.Fatalf("expected only the named pipeline, got %v", metrics)
+	}
+
+	orders := metrics["orders"]
+	for name, want := range map[string][2]int64{"map": {10, 10}, "filter": {10, 4}} {
+		got := orders[name]
+		if got.Received != want[0] || got.Emitted != want[1] || got.Errors != 0 {
+			t.Fatalf("unexpected %s metrics %+v", name, got)
+		}
+		if got.Latency.Count != 10 || got.Latency.Buckets["+Inf"] != 10 {
+			t.Fatalf("unexpected %s latency %+v", name, got.Latency)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package chankit
+
+import (
+	"context"
+	"time"
+)
+
+// Observer receives events from pipeline stages, e.g. to collect metrics.
+//
+// It is attached to a single stage with WithObserver, or to every stage of a
+// pipeline with WithPipelineObserver. Methods are called synchronously from
+// the stage goroutines, possibly concurrently, so they must be cheap and
+// safe for concurrent use.
+type Observer interface {
+	// OnReceive is called when the stage reads an element from its input.
+	OnReceive(s StageInfo)
+	// OnEmit is called when the stage sends an element downstream.
+	OnEmit(s StageInfo)
+	// OnError is called when the user function of the stage fails.
+	OnError(s StageInfo, err error)
+	// OnFnLatency is called when a call of the user function returns.
+	OnFnLatency(s StageInfo, d time.Duration)
+	// QueueDepth is called after every emit with the number of elements
+	// buffered in the output channel of the stage.
+	QueueDepth(s StageInfo, n int)
+}
+
+// StageInfo identifies the stage an Observer event comes from.
+type StageInfo struct {
+	Pipeline string // set with WithPipelineName
+	Kind     string // e.g. "map" or "filter"
+	Name     string // set with WithName, defaults to Kind and a sequence number
+
+	unnamedPipeline bool // Pipeline is a generated name
+}
+
+// stageObserver reports the events of one stage. A nil *stageObserver is
+// valid and reports nothing, so unobserved stages only pay a nil check.
+type stageObserver struct {
+	obs   Observer
+	info  StageInfo
+	clock Clock
+}
+
+func (s *stageObserver) receive() {
+	if s != nil {
+		s.obs.OnReceive(s.info)
+	}
+}
+
+func (s *stageObserver) emit(queued int) {
+	if s != nil {
+		s.obs.OnEmit(s.info)
+		s.obs.QueueDepth(s.info, queued)
+	}
+}
+
+// called reports a call of the user function that started at start.
+// Errors caused by the cancellation of the stage are not reported.
+func (s *stageObserver) called(ctx context.Context, start time.Time, err error) {
+	s.obs.OnFnLatency(s.info, s.clock.Now().Sub(start))
+	if err != nil && ctx.Err() == nil {
+		s.obs.OnError(s.info, err)
+	}
+}
+
+// failed reports an element that failed without a call of the user function.
+func (s *stageObserver) failed(err error) {
+	if s != nil {
+		s.obs.OnError(s.info, err)
+	}
+}
+
+// observedFunc reports the latency and errors of the calls of fn.
+func observedFunc[A, B any](
+	s *stageObserver,
+	fn func(context.Context, A) (B, error),
+) func(context.Context, A) (B, error) {
+	if s == nil {
+		return fn
+	}
+	return func(ctx context.Context, a A) (B, error) {
+		start := s.clock.Now()
+		b, err := fn(ctx, a)
+		s.called(ctx, start, err)
+		return b, err
+	}
+}
@@ -0,0 +1,123 @@
+package chankit
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"sync"
+	"testing"
+	"time"
+)
+
+type stageCounts struct {
+	received, emitted, errors, calls int
+}
+
+// countingObserver counts the events of every stage by name.
+type countingObserver struct {
+	mu     sync.Mutex
+	stages map[string]stageCounts
+}
+
+func newCountingObserver() *countingObserver {
+	return &countingObserver{stages: make(map[string]stageCounts)}
+}
+
+func (o *countingObserver) update(s StageInfo, fn func(*stageCounts)) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	c := o.stages[s.Name]
+	fn(&c)
+	o.stages[s.Name] = c
+}
+
+func (o *countingObserver) OnReceive(s StageInfo) {
+	o.update(s, func(c *stageCounts) { c.received++ })
+}
+
+func (o *countingObserver) OnEmit(s StageInfo) {
+	o.update(s, func(c *stageCounts) { c.emitted++ })
+}
+
+func (o *countingObserver) OnError(s StageInfo, _ error) {
+	o.update(s, func(c *stageCounts) { c.errors++ })
+}
+
+func (o *countingObserver) OnFnLatency(s StageInfo, _ time.Duration) {
+	o.update(s, func(c *stageCounts) { c.calls++ })
+}
+
+func (o *countingObserver) QueueDepth(StageInfo, int) {}
+
+func (o *countingObserver) snapshot() map[string]stageCounts {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return maps.Clone(o.stages)
+}
+
+func TestObserver(t *testing.T) {
+	t.Run("pipeline", func(t *testing.T) {
+		t.Parallel()
+
+		obs := newCountingObserver()
+		p, ctx := NewPipeline(t.Context(), WithPipelineObserver(obs))
+
+		left := Drop(ctx, p, slice2chan(genInts(10)), 2, WithName("drop"))
+		right := Take(ctx, p, slice2chan(genInts(10)), 3, WithName("take"))
+		merged := Merge(ctx, p, left, right, WithName("merge"))
+		mapped := Map(ctx, p, merged, func(x int) int { return x }, WithParallel(2))
+		even := Filter(ctx, p, mapped, func(x int) bool { return x%2 == 0 }, WithName("filter"))
+		sum := <-Fold(ctx, p, even, 0, func(acc, x int) int { return acc + x }, WithName("fold"))
+
+		assertNoPipeError(t, p)
+		if sum != 2+4+6+8+0+2 {
+			t.Fatalf("unexpected sum %d", sum)
+		}
+
+		want := map[string]stageCounts{
+			"drop":   {received: 10, emitted: 8},
+			"take":   {received: 3, emitted: 3},
+			"merge":  {received: 11, emitted: 11},
+			"map-4":  {received: 11, emitted: 11, calls: 11},
+			"filter": {received: 11, emitted: 6, calls: 11},
+			"fold":   {received: 6, emitted: 1, calls: 6},
+		}
+		if got := obs.snapshot(); !maps.Equal(want, got) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("stage", func(t *testing.T) {
+		t.Parallel()
+
+		errBoom := errors.New("boom")
+		pipeObs, stageObs := newCountingObserver(), newCountingObserver()
+		p, ctx := NewPipeline(t.Context(), WithPipelineObserver(pipeObs))
+
+		fn := func(_ context.Context, x int) (int, error) {
+			if x == 2 {
+				return 0, errBoom
+			}
+			return x, nil
+		}
+		for range MapErrCtx(
+			ctx,
+			p,
+			slice2chan(genInts(5)),
+			fn,
+			WithName("m"),
+			WithObserver(stageObs),
+		) {
+		}
+
+		if err := p.Wait(); !errors.Is(err, errBoom) {
+			t.Fatalf("expected %v, got %v", errBoom, err)
+		}
+		if got := stageObs.snapshot()["m"]; got.errors != 1 || got.calls != 3 {
+			t.Fatalf("unexpected stage counts %+v", got)
+		}
+		if got := pipeObs.snapshot(); len(got) != 0 {
+			t.Fatalf("stage observer must override the pipeline one, got %v", got)
+		}
+	})
+}
@@ -1,7 +1,10 @@
 package chankit
 
 import (
+	"context"
 	"runtime"
+	"sync/atomic"
+	"time"
 )
 
 type Option func(*config)
@@ -23,12 +26,121 @@ func WithParallel(n ...int) Option {
 	}
 }
 
+// WithAdaptiveParallel runs a Map stage with between minN and maxN workers,
+// adjusting the number of active ones while it runs: it grows while calls
+// succeed at a steady latency and backs off on errors and latency spikes.
+func WithAdaptiveParallel(minN, maxN int) Option {
+	minN = max(minN, 1)
+	maxN = max(maxN, minN)
+
+	return func(c *config) {
+		c.parOpt.n = maxN
+		c.parOpt.minN = minN
+		c.parOpt.adaptive = true
+	}
+}
+
+// WithParallelControl lets ctrl change the number of workers of a Map stage
+// while it runs. The stage runs in parallel even with fewer than 2 workers,
+// so that it can be scaled up later. Unless set with WithReorderWindow, the
+// reorder window of an ordered stage follows the number of workers.
+func WithParallelControl(ctrl *ParallelControl) Option {
+	return func(c *config) {
+		c.parOpt.ctrl = ctrl
+	}
+}
+
+// WithConcurrencyLimiter makes a Map or Filter stage hold units of l for
+// every call of its function, so that stages sharing l share its capacity.
+func WithConcurrencyLimiter(l *Limiter) Option {
+	return func(c *config) {
+		c.limiter = l
+	}
+}
+
+// WithLimiterWeight sets how many units of the WithConcurrencyLimiter limiter
+// a call takes for a given element. It is ignored by stages whose input
+// elements are not of type A.
+func WithLimiterWeight[A any](fn func(A) int64) Option {
+	return func(c *config) {
+		c.limiterWeight = fn
+	}
+}
+
+// WithCircuitBreaker guards the function of a Map stage with a circuit
+// breaker. It opens when at least failureRate of the last `window` calls
+// failed, and then rejects calls with ErrCircuitOpen for coolDown (see
+// WithClock). After that, a single trial call decides whether it closes or
+// opens again.
+//
+// Rejected calls are reported to the stage Observer with OnError, and fail
+// the stage like any other error unless WithDeadLetter is set.
+func WithCircuitBreaker(failureRate float64, window int, coolDown time.Duration) Option {
+	if failureRate <= 0 || failureRate > 1 {
+		panic("WithCircuitBreaker: failureRate must be in (0, 1]")
+	}
+	if window <= 0 {
+		panic("WithCircuitBreaker: window must be > 0")
+	}
+	return func(c *config) {
+		c.breaker = &breakerOpt{failureRate: failureRate, window: window, coolDown: coolDown}
+	}
+}
+
+// WithDeadLetter makes a Map stage skip elements whose function call
+// failed, including calls rejected with ErrCircuitOpen or timed out with
+// ErrElementTimeout, and pass them with their error to fn instead of failing
+// the pipeline. A must match the stage input type.
+//
+// fn is called by the worker that processed the element, so with
+// WithParallel it is called concurrently and must be safe for concurrent use.
+func WithDeadLetter[A any](fn func(A, error)) Option {
+	return func(c *config) {
+		c.deadLetter = fn
+	}
+}
+
+// WithName names a stage in Observer events. Unnamed stages are named after
+// their kind and a sequence number.
+func WithName(name string) Option {
+	return func(c *config) {
+		c.name = name
+	}
+}
+
+// WithObserver attaches obs to a stage, overriding the observer of its
+// pipeline (see WithPipelineObserver).
+func WithObserver(obs Observer) Option {
+	return func(c *config) {
+		c.observer = obs
+	}
+}
+
+// WithTracer attaches t to a Map or Filter stage, overriding the tracer of
+// its pipeline (see WithPipelineTracer).
+func WithTracer(t Tracer) Option {
+	return func(c *config) {
+		c.tracer = t
+	}
+}
+
 func WithUnordered() Option {
 	return func(c *config) {
 		c.parOpt.unordered = true
 	}
 }
 
+// WithSizeFunc sets how many bytes an element emitted by a stage takes.
+// Within a pipeline created with WithMemoryBudget, the elements buffered by
+// the stage (WithBuffer, Buffer, Map reorder window) are accounted against
+// the budget.
+// It is ignored by stages whose elements are not of type A.
+func WithSizeFunc[A any](fn func(A) int) Option {
+	return func(c *config) {
+		c.sizeFn = fn
+	}
+}
+
 // should be rarely used
 func WithReorderWindow(maxGap int) Option {
 	return func(c *config) {
@@ -36,6 +148,14 @@ func WithReorderWindow(maxGap int) Option {
 	}
 }
 
+// WithElementTimeout bounds every call of a Map function by its own deadline
+// of d. A call that misses it fails with an error wrapping ErrElementTimeout.
+func WithElementTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.elemTimeout = max(d, 0)
+	}
+}
+
 type HaltStrategy int
 
 const (
@@ -60,26 +180,174 @@ func (h HaltStrategy) String() string {
 	}
 }
 
+// halted reports whether a two-input stage should stop given which sides
+// have finished.
+func (h HaltStrategy) halted(leftDone, rightDone bool) (bool, error) {
+	switch h {
+	case HaltLeft:
+		return leftDone, nil
+	case HaltRight:
+		return rightDone, nil
+	case HaltEither:
+		return leftDone || rightDone, nil
+	case HaltBoth:
+		return leftDone && rightDone, nil
+	default:
+		return true, ErrUnknownHaltStrategy
+	}
+}
+
 func WithHaltStrategy(s HaltStrategy) Option {
 	return func(c *config) {
 		c.haltStrategy = s
+		c.haltSet = true
+	}
+}
+
+// WithClock sets the clock used by time-driven stages.
+// A nil clock resets it to the system clock.
+func WithClock(clk Clock) Option {
+	return func(c *config) {
+		if clk == nil {
+			clk = realClock{}
+		}
+		c.clock = clk
+	}
+}
+
+// WithFlushInterval makes keyed stages periodically emit the current
+// accumulator of every live key.
+func WithFlushInterval(d time.Duration) Option {
+	return func(c *config) {
+		c.keyed.flushEvery = max(d, 0)
+	}
+}
+
+// WithKeyIdle makes keyed stages emit and forget a key that has not been
+// updated for d.
+func WithKeyIdle(d time.Duration) Option {
+	return func(c *config) {
+		c.keyed.idle = max(d, 0)
+	}
+}
+
+// WithMaxKeys bounds the number of distinct keys kept by keyed stages and
+// Distinct.
+// When the bound is hit, the least recently updated key is evicted.
+func WithMaxKeys(n int) Option {
+	return func(c *config) {
+		c.keyed.maxKeys = max(n, 0)
+	}
+}
+
+// WithKeyTTL makes Distinct forget a key d after it was first seen.
+func WithKeyTTL(d time.Duration) Option {
+	return func(c *config) {
+		c.keyed.ttl = max(d, 0)
+	}
+}
+
+// WithBloomFilter makes Distinct track keys in a Bloom filter sized for
+// expectedKeys distinct keys at the given false positive rate. Memory stays
+// fixed, at the cost of occasionally dropping a key that was never seen.
+func WithBloomFilter(expectedKeys int, fpRate float64) Option {
+	return func(c *config) {
+		c.keyed.bloomKeys = max(expectedKeys, 1)
+		c.keyed.bloomFPRate = fpRate
+	}
+}
+
+// WithEvictFunc registers a callback invoked by keyed stages whenever a key
+// is evicted before the input closes. K and B must match the stage types.
+func WithEvictFunc[K comparable, B any](fn func(K, B)) Option {
+	return func(c *config) {
+		c.keyed.onEvict = fn
+	}
+}
+
+// WithAllowedLateness keeps event-time windows open for d after the
+// watermark passed their end, so that late elements still update them.
+func WithAllowedLateness(d time.Duration) Option {
+	return func(c *config) {
+		c.lateness = max(d, 0)
+	}
+}
+
+// WithStrictLength makes Zip-like stages fail with ErrLengthMismatch instead
+// of padding with zero values when one side finishes before the other.
+func WithStrictLength() Option {
+	return func(c *config) {
+		c.strictLength = true
+	}
+}
+
+// WithUpstreamCancel makes Take, TakeWhile, TakeUntil and TimeoutWith call
+// cancel, typically obtained from UpstreamScope, instead of draining their
+// input once they need no more elements.
+func WithUpstreamCancel(cancel context.CancelFunc) Option {
+	return func(c *config) {
+		c.upstreamCancel = cancel
+	}
+}
+
+// WithDropCounter makes Buffer add the number of discarded elements to cnt,
+// which can be read concurrently for monitoring.
+func WithDropCounter(cnt *atomic.Int64) Option {
+	return func(c *config) {
+		c.dropCnt = cnt
 	}
 }
 
 type parOpt struct {
 	n             int
+	minN          int
+	adaptive      bool
+	ctrl          *ParallelControl
 	unordered     bool
 	reorderWindow int
 }
 
+type keyedOpt struct {
+	flushEvery time.Duration
+	idle       time.Duration
+	maxKeys    int
+	onEvict    any // func(K, B)
+
+	ttl         time.Duration
+	bloomKeys   int
+	bloomFPRate float64
+}
+
 type config struct {
-	bufCap       int
-	parOpt       parOpt
+	name     string
+	observer Observer
+	tracer   Tracer
+
+	bufCap      int
+	queued      func() int // elements held by the makeOut forwarder, if any
+	sizeFn      any        // func(A) int
+	parOpt      parOpt
+	elemTimeout time.Duration
+
+	limiter       *Limiter
+	limiterWeight any // func(A) int64
+
+	breaker    *breakerOpt
+	deadLetter any // func(A, error)
+
 	haltStrategy HaltStrategy
+	haltSet      bool
+	clock        Clock
+	keyed        keyedOpt
+	lateness     time.Duration
+	strictLength bool
+	dropCnt      *atomic.Int64
+
+	upstreamCancel context.CancelFunc
 }
 
 func makeConfig(opts []Option) *config {
-	cfg := &config{}
+	cfg := &config{clock: realClock{}}
 	for _, opt := range opts {
 		opt(cfg)
 	}
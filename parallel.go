@@ -0,0 +1,267 @@
+package chankit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// workerGate bounds how many of the workers of a parallel stage may process
+// an element at the same time. The bound can change while the stage runs.
+// A nil gate admits every worker.
+type workerGate struct {
+	mu      sync.Mutex
+	limit   int
+	active  int
+	changed chan struct{} // closed and replaced whenever a slot may free up
+}
+
+func newWorkerGate(limit int) *workerGate {
+	return &workerGate{limit: max(limit, 1), changed: make(chan struct{})}
+}
+
+func (g *workerGate) acquire(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	for {
+		g.mu.Lock()
+		if g.active < g.limit {
+			g.active++
+			g.mu.Unlock()
+			return nil
+		}
+		changed := g.changed
+		g.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (g *workerGate) release() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.active--
+	g.notifyLocked()
+}
+
+func (g *workerGate) setLimit(n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.limit = max(n, 1)
+	g.notifyLocked()
+}
+
+func (g *workerGate) getLimit() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.limit
+}
+
+func (g *workerGate) notifyLocked() {
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+const (
+	aimdLatencyTolerance = 2    // latency above tolerance * baseline is a spike
+	aimdBackoff          = 0.75 // multiplicative decrease factor
+	aimdBaselineWeight   = 0.05 // weight of a new sample in the latency baseline
+)
+
+// aimdLimiter adapts the limit of a workerGate within [minN, maxN]: it grows
+// by one worker per window of successful calls and shrinks multiplicatively
+// on errors and latency spikes.
+type aimdLimiter struct {
+	gate       *workerGate
+	minN, maxN int
+
+	mu       sync.Mutex
+	limit    float64
+	baseline float64 // moving average of call latency, in ns
+	cooldown int     // calls to observe before the next decrease
+}
+
+func newAIMDLimiter(gate *workerGate, minN, maxN int) *aimdLimiter {
+	gate.setLimit(minN)
+	return &aimdLimiter{gate: gate, minN: minN, maxN: maxN, limit: float64(minN)}
+}
+
+func (l *aimdLimiter) observe(latency time.Duration, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sample := float64(latency)
+	spike := l.baseline > 0 && sample > aimdLatencyTolerance*l.baseline
+	if l.baseline == 0 {
+		l.baseline = sample
+	} else {
+		l.baseline += aimdBaselineWeight * (sample - l.baseline)
+	}
+
+	if l.cooldown > 0 {
+		l.cooldown--
+	}
+
+	switch {
+	case err != nil || spike:
+		if l.cooldown > 0 {
+			return
+		}
+		l.limit = max(l.limit*aimdBackoff, float64(l.minN))
+		l.cooldown = int(l.limit)
+	default:
+		l.limit = min(l.limit+1/l.limit, float64(l.maxN))
+	}
+
+	l.gate.setLimit(int(l.limit))
+}
+
+// withAdaptiveLimit makes every call of fn feed the limiter.
+func withAdaptiveLimit[A, B any](
+	fn func(context.Context, A) (B, error),
+	l *aimdLimiter,
+	clock Clock,
+) func(context.Context, A) (B, error) {
+	return func(ctx context.Context, a A) (B, error) {
+		start := clock.Now()
+		b, err := fn(ctx, a)
+		l.observe(clock.Now().Sub(start), err)
+		return b, err
+	}
+}
+
+// workerPool tracks the workers of a parallel stage. Workers can be added or
+// retired while the stage runs; onDone is called once the last one exits.
+type workerPool struct {
+	onDone func()
+
+	mu     sync.Mutex
+	live   int
+	target int
+	done   bool
+}
+
+// resize sets the desired number of workers: missing ones are started right
+// away, extra ones retire when they next check their retire func.
+func (w *workerPool) resize(
+	ctx context.Context,
+	p *Pipeline,
+	n int,
+	work func(retire func() bool) error,
+) {
+	w.mu.Lock()
+	if w.done {
+		w.mu.Unlock()
+		return
+	}
+	w.target = max(n, 1)
+	add := max(w.target-w.live, 0)
+	w.live += add
+	w.mu.Unlock()
+
+	for range add {
+		p.goSafe(ctx, func() error {
+			retired := false
+			defer func() {
+				if !retired {
+					w.exit()
+				}
+			}()
+			return work(func() bool {
+				retired = w.retire()
+				return retired
+			})
+		})
+	}
+}
+
+func (w *workerPool) retire() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.live > w.target {
+		w.live--
+		return true
+	}
+	return false
+}
+
+func (w *workerPool) exit() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.live--
+	if w.live == 0 {
+		w.done = true
+		w.onDone()
+	}
+}
+
+// ParallelControl changes the number of workers of a running parallel Map
+// stage, see WithParallelControl. A control drives a single stage.
+//
+// The zero value is ready to use.
+type ParallelControl struct {
+	mu     sync.Mutex
+	n      int
+	resize func(n int)
+}
+
+// SetParallel sets the number of workers of the controlled stage.
+// New workers start right away; extra workers retire gracefully once they
+// finish their current element. Values below 1 are treated as 1.
+// If the stage has not started yet, n replaces its initial parallelism.
+func (c *ParallelControl) SetParallel(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.n = max(n, 1)
+	if c.resize != nil {
+		c.resize(c.n)
+	}
+}
+
+// Parallel returns the current number of workers requested for the stage.
+func (c *ParallelControl) Parallel() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+// initial returns the parallelism a stage configured with n workers should
+// start with. A nil control keeps n.
+func (c *ParallelControl) initial(n int) int {
+	if c == nil {
+		return n
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.n > 0 {
+		return c.n
+	}
+	return max(n, 1)
+}
+
+// attach binds the control to a stage started with n workers.
+// A nil control is ignored.
+func (c *ParallelControl) attach(n int, resize func(n int)) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resize != nil {
+		panic("ParallelControl: already attached to a stage")
+	}
+	c.resize = resize
+	if c.n > 0 && c.n != n {
+		resize(c.n) // changed while the stage was starting
+	} else {
+		c.n = n
+	}
+}
@@ -0,0 +1,244 @@
+package chankit
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWorkerGate(t *testing.T) {
+	t.Parallel()
+
+	g := newWorkerGate(2)
+	ctx := t.Context()
+
+	for range 2 {
+		if err := g.acquire(ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	blockedCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := g.acquire(blockedCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected acquire to block, got %v", err)
+	}
+
+	acquired := make(chan struct{})
+	go func() {
+		_ = g.acquire(ctx)
+		close(acquired)
+	}()
+	g.setLimit(3)
+
+	select {
+	case <-acquired:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("raising the limit must admit a waiting worker")
+	}
+}
+
+func TestAIMDLimiter(t *testing.T) {
+	t.Parallel()
+
+	g := newWorkerGate(1)
+	l := newAIMDLimiter(g, 2, 8)
+	if n := g.getLimit(); n != 2 {
+		t.Fatalf("expected limit to start at min, got %d", n)
+	}
+
+	for range 100 {
+		l.observe(time.Millisecond, nil)
+	}
+	if n := g.getLimit(); n != 8 {
+		t.Fatalf("expected limit to grow to max, got %d", n)
+	}
+
+	l.observe(10*time.Millisecond, nil)
+	if n := g.getLimit(); n != 6 {
+		t.Fatalf("expected limit to back off on latency spike, got %d", n)
+	}
+
+	// further spikes within the cooldown do not compound
+	l.observe(10*time.Millisecond, nil)
+	if n := g.getLimit(); n != 6 {
+		t.Fatalf("expected a single back off, got %d", n)
+	}
+
+	for range 100 {
+		l.observe(time.Millisecond, errors.New("boom"))
+	}
+	if n := g.getLimit(); n != 2 {
+		t.Fatalf("expected limit to back off to min on errors, got %d", n)
+	}
+}
+
+func TestMapAdaptiveParallel(t *testing.T) {
+	tests := []struct {
+		name      string
+		unordered bool
+	}{
+		{"ordered", false},
+		{"unordered", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var active, peak atomic.Int32
+			work := func(_ context.Context, x int) (int, error) {
+				n := active.Add(1)
+				defer active.Add(-1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				// overloaded above 4 concurrent calls
+				time.Sleep(time.Duration(max(n-4, 0)+1) * 100 * time.Microsecond)
+				return x * mul, nil
+			}
+
+			opts := []Option{WithAdaptiveParallel(1, 8)}
+			if tc.unordered {
+				opts = append(opts, WithUnordered())
+			}
+
+			items := genInts(500)
+			p, ctx := NewPipeline(t.Context())
+			out := MapErrCtx(ctx, p, slice2chan(items), work, opts...)
+			got := chan2slice(out)
+
+			check(t, p, items, got, !tc.unordered, mul)
+			if n := peak.Load(); n > 8 {
+				t.Fatalf("expected at most 8 concurrent calls, got %d", n)
+			}
+		})
+	}
+}
+
+func TestMapParallelControl(t *testing.T) {
+	type tracker struct {
+		active, peak atomic.Int32
+	}
+	enter := func(tr *tracker) {
+		n := tr.active.Add(1)
+		for {
+			p := tr.peak.Load()
+			if n <= p || tr.peak.CompareAndSwap(p, n) {
+				return
+			}
+		}
+	}
+	waitActive := func(t *testing.T, tr *tracker, n int32) {
+		t.Helper()
+		deadline := time.After(time.Second)
+		for tr.active.Load() != n {
+			select {
+			case <-deadline:
+				t.Fatalf("expected %d active workers, got %d", n, tr.active.Load())
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}
+
+	for _, unordered := range []bool{false, true} {
+		name := "ordered"
+		if unordered {
+			name = "unordered"
+		}
+
+		t.Run(name+" scale up", func(t *testing.T) {
+			t.Parallel()
+
+			var tr tracker
+			tokens := make(chan struct{})
+			work := func(_ context.Context, x int) (int, error) {
+				enter(&tr)
+				defer tr.active.Add(-1)
+				<-tokens
+				return x * mul, nil
+			}
+
+			var ctrl ParallelControl
+			opts := []Option{WithParallel(1), WithParallelControl(&ctrl)}
+			if unordered {
+				opts = append(opts, WithUnordered())
+			}
+
+			items := genInts(100)
+			p, ctx := NewPipeline(t.Context())
+			out := MapErrCtx(ctx, p, slice2chan(items), work, opts...)
+			res := make(chan []int)
+			go func() { res <- chan2slice(out) }()
+
+			// well above the default reorder window of the initial parallelism
+			waitActive(t, &tr, 1)
+			ctrl.SetParallel(16)
+			waitActive(t, &tr, 16)
+			if n := ctrl.Parallel(); n != 16 {
+				t.Fatalf("expected parallelism 16, got %d", n)
+			}
+			close(tokens)
+
+			check(t, p, items, <-res, !unordered, mul)
+		})
+
+		t.Run(name+" scale down", func(t *testing.T) {
+			t.Parallel()
+
+			var tr, late tracker
+			tokens := make(chan struct{})
+			work := func(_ context.Context, x int) (int, error) {
+				enter(&tr)
+				defer tr.active.Add(-1)
+				if x >= 4 {
+					enter(&late)
+					defer late.active.Add(-1)
+				}
+				<-tokens
+				return x * mul, nil
+			}
+
+			var ctrl ParallelControl
+			opts := []Option{WithParallel(4), WithParallelControl(&ctrl)}
+			if unordered {
+				opts = append(opts, WithUnordered())
+			}
+
+			items := genInts(100)
+			p, ctx := NewPipeline(t.Context())
+			out := MapErrCtx(ctx, p, slice2chan(items), work, opts...)
+			res := make(chan []int)
+			go func() { res <- chan2slice(out) }()
+
+			waitActive(t, &tr, 4)
+			ctrl.SetParallel(1)
+			close(tokens)
+
+			check(t, p, items, <-res, !unordered, mul)
+			if n := late.peak.Load(); n > 1 {
+				t.Fatalf("expected a single worker after scaling down, got %d", n)
+			}
+		})
+	}
+
+	t.Run("attached twice", func(t *testing.T) {
+		t.Parallel()
+
+		defer func() {
+			if recover() == nil {
+				t.Fatal("panic expected")
+			}
+		}()
+
+		var ctrl ParallelControl
+		p, ctx := NewPipeline(t.Context())
+		_ = Map(ctx, p, make(chan int), func(x int) int { return x }, WithParallelControl(&ctrl))
+		_ = Map(ctx, p, make(chan int), func(x int) int { return x }, WithParallelControl(&ctrl))
+	})
+}
@@ -2,20 +2,115 @@ package chankit
 
 import (
 	"context"
+	"errors"
+	"log/slog"
+	"strconv"
 	"sync"
+	"sync/atomic"
 )
 
+// ErrUpstreamCanceled is the cancellation cause of contexts created by
+// UpstreamScope once their stages are no longer needed.
+var ErrUpstreamCanceled = errors.New("upstream canceled by downstream stage")
+
 type Pipeline struct {
+	name   string
 	cancel context.CancelFunc
+	mem    *memBudget
+	obs    Observer
+	log    *slog.Logger
+	tracer Tracer
+
+	unnamed bool  // name was generated, see WithPipelineName
+	clock   Clock // of pipeline-wide timers, see WithPipelineClock
+
+	diagnostics bool // see WithDiagnostics
+	watchdog    func(ctx context.Context)
+
+	stageSeq atomic.Int64
+	stages   []*stage // guarded by mu
 
 	wg  sync.WaitGroup
 	err error
 	mu  sync.Mutex
 }
 
-func NewPipeline(ctx context.Context) (*Pipeline, context.Context) {
+type PipelineOption func(*Pipeline)
+
+// pipelineSeq numbers unnamed pipelines.
+var pipelineSeq atomic.Int64
+
+// WithPipelineName names the pipeline in Observer events. Unnamed pipelines
+// are named "pipeline" followed by a sequence number.
+func WithPipelineName(name string) PipelineOption {
+	return func(p *Pipeline) {
+		p.name = name
+	}
+}
+
+// WithMemoryBudget bounds the total size in bytes of the elements buffered
+// by the stages of the pipeline that have a size func (see WithSizeFunc).
+// Stages block instead of buffering more once the budget is exhausted.
+func WithMemoryBudget(bytes int64) PipelineOption {
+	return func(p *Pipeline) {
+		if bytes > 0 {
+			p.mem = newMemBudget(bytes)
+		}
+	}
+}
+
+// WithPipelineObserver attaches obs to every stage of the pipeline that does
+// not have its own observer (see WithObserver).
+func WithPipelineObserver(obs Observer) PipelineOption {
+	return func(p *Pipeline) {
+		p.obs = obs
+	}
+}
+
+// WithPipelineTracer attaches t to every Map and Filter stage of the
+// pipeline that does not have its own tracer (see WithTracer).
+func WithPipelineTracer(t Tracer) PipelineOption {
+	return func(p *Pipeline) {
+		p.tracer = t
+	}
+}
+
+// WithPipelineClock sets the clock used by the pipeline itself, e.g. by its
+// watchdog and diagnostics (see WithWatchdog). Stages keep their own clock, see WithClock.
+// A nil clock resets it to the system clock.
+func WithPipelineClock(clk Clock) PipelineOption {
+	return func(p *Pipeline) {
+		if clk == nil {
+			clk = realClock{}
+		}
+		p.clock = clk
+	}
+}
+
+// WithLogger makes the pipeline log the lifecycle of its stages to l: stage
+// starts and stops at debug level, with the cancellation cause of stopped
+// stages, and the first error of the pipeline at error level.
+// Pipelines are silent by default.
+func WithLogger(l *slog.Logger) PipelineOption {
+	return func(p *Pipeline) {
+		p.log = l
+	}
+}
+
+func NewPipeline(ctx context.Context, opts ...PipelineOption) (*Pipeline, context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
-	return &Pipeline{cancel: cancel}, ctx
+	p := &Pipeline{cancel: cancel, clock: realClock{}}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.name == "" {
+		p.name = "pipeline-" + strconv.FormatInt(pipelineSeq.Add(1), 10)
+		p.unnamed = true
+	}
+	if p.watchdog != nil {
+		go p.watchdog(ctx)
+	}
+	return p, ctx
 }
 
 func (p *Pipeline) Wait() error {
@@ -26,17 +121,54 @@ func (p *Pipeline) Wait() error {
 	return p.err
 }
 
-func (p *Pipeline) goSafe(fn func() error) {
+// UpstreamScope derives a cancellation scope for the stages feeding a
+// Take-like stage. Passing the returned cancel func to that stage with
+// WithUpstreamCancel lets it stop them once it needs no more elements.
+//
+// Stages stopped this way do not fail the pipeline.
+func UpstreamScope(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return ctx, func() { cancel(ErrUpstreamCanceled) }
+}
+
+// goSafe runs fn as part of the pipeline. ctx is the context of the stage fn
+// belongs to: cancellation errors caused by UpstreamScope are not recorded.
+func (p *Pipeline) goSafe(ctx context.Context, fn func() error) {
+	st := stageFrom(ctx)
+	st.enter()
+
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
-		if err := fn(); err != nil {
-			p.mu.Lock()
-			if p.err == nil { // first one wins
-				p.err = err
-				p.cancel()
-			}
-			p.mu.Unlock()
+		err := fn()
+		defer func() { st.exit(ctx, err) }()
+
+		if errors.Is(err, context.Canceled) && errors.Is(context.Cause(ctx), ErrUpstreamCanceled) {
+			return
+		}
+		if err != nil {
+			p.fail(st, err)
 		}
 	}()
 }
+
+// fail records err, reported by stage st if not nil, as the error of the
+// pipeline and cancels it, unless it already failed.
+func (p *Pipeline) fail(st *stage, err error) {
+	p.mu.Lock()
+	first := p.err == nil
+	if first { // first one wins
+		p.err = err
+		p.cancel()
+	}
+	p.mu.Unlock()
+
+	if first && p.log != nil {
+		attrs := []any{slog.String("pipeline", p.name), slog.Any("err", err)}
+		if st != nil {
+			attrs = st.attrs()
+			attrs = append(attrs, slog.Any("err", err))
+		}
+		p.log.Error("pipeline failed", attrs...)
+	}
+}
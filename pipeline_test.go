@@ -0,0 +1,100 @@
+package chankit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+type logRecord struct {
+	Msg      string
+	Pipeline string
+	Stage    string
+	Drained  int
+	Err      string
+}
+
+// captureLogs returns a debug logger and a function returning its records.
+func captureLogs(t *testing.T) (*slog.Logger, func() []logRecord) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	return logger, func() []logRecord {
+		var records []logRecord
+		for line := range bytes.Lines(buf.Bytes()) {
+			var r logRecord
+			if err := json.Unmarshal(line, &r); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			records = append(records, r)
+		}
+		return records
+	}
+}
+
+func findLog(t *testing.T, records []logRecord, msg, stage string) logRecord {
+	t.Helper()
+	for _, r := range records {
+		if r.Msg == msg && r.Stage == stage {
+			return r
+		}
+	}
+	t.Fatalf("no %q record for stage %q in %+v", msg, stage, records)
+	return logRecord{}
+}
+
+func TestPipelineLogger(t *testing.T) {
+	t.Run("lifecycle", func(t *testing.T) {
+		t.Parallel()
+
+		logger, logs := captureLogs(t)
+		p, ctx := NewPipeline(t.Context(), WithPipelineName("orders"), WithLogger(logger))
+
+		got := chan2slice(Take(ctx, p, slice2chan(genInts(10)), 3, WithName("take")))
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, []int{0, 1, 2}, got)
+
+		records := logs()
+		for _, r := range records {
+			if r.Pipeline != "orders" {
+				t.Fatalf("unexpected pipeline in %+v", r)
+			}
+		}
+		findLog(t, records, "stage started", "take")
+		if r := findLog(t, records, "stage drained", "take"); r.Drained != 7 {
+			t.Fatalf("expected 7 drained elements, got %+v", r)
+		}
+		if r := findLog(t, records, "stage stopped", "take"); r.Err != "" {
+			t.Fatalf("unexpected error in %+v", r)
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		t.Parallel()
+
+		errBoom := errors.New("boom")
+		logger, logs := captureLogs(t)
+		p, ctx := NewPipeline(t.Context(), WithLogger(logger))
+
+		for range MapErr(ctx, p, slice2chan(genInts(10)), func(x int) (int, error) {
+			if x == 2 {
+				return 0, errBoom
+			}
+			return x, nil
+		}, WithName("map")) {
+		}
+		if err := p.Wait(); !errors.Is(err, errBoom) {
+			t.Fatalf("expected %v, got %v", errBoom, err)
+		}
+
+		records := logs()
+		if r := findLog(t, records, "pipeline failed", "map"); r.Err != errBoom.Error() {
+			t.Fatalf("unexpected error in %+v", r)
+		}
+		if r := findLog(t, records, "stage stopped", "map"); r.Err != errBoom.Error() {
+			t.Fatalf("unexpected error in %+v", r)
+		}
+	})
+}
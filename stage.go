@@ -0,0 +1,217 @@
+package chankit
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// stage is the runtime record of a stage, registered in its pipeline.
+type stage struct {
+	p    *Pipeline
+	info StageInfo
+	obs  *stageObserver // nil when unobserved
+
+	ins     []any // input channels
+	out     any   // output channel
+	bufSize int
+	queued  func() int // overrides the output length, see makeOut
+
+	received atomic.Int64
+	emitted  atomic.Int64
+
+	// running counts the goroutines of the stage, plus one while it is
+	// being built, so that it is not seen as stopped before it starts
+	running atomic.Int64
+
+	mu       sync.Mutex
+	err      error      // first error of the stage goroutines
+	parallel func() int // current number of workers, nil for one
+	probes   map[*probe]struct{}
+}
+
+type stageKey struct{}
+
+// newStage registers a new stage of the given kind reading from ins and
+// writing to out. The returned context carries the stage, so that the
+// goroutines started with it through goSafe are accounted to it. The caller
+// must call launched once the stage goroutines are started.
+func (p *Pipeline) newStage(
+	ctx context.Context,
+	cfg *config,
+	kind string,
+	out any,
+	ins ...any,
+) (*stage, context.Context) {
+	seq := p.stageSeq.Add(1)
+	name := cfg.name
+	if name == "" {
+		name = kind + "-" + strconv.FormatInt(seq, 10)
+	}
+
+	st := &stage{
+		p:       p,
+		info:    StageInfo{Pipeline: p.name, Kind: kind, Name: name, unnamedPipeline: p.unnamed},
+		ins:     ins,
+		out:     out,
+		bufSize: cfg.bufCap,
+		queued:  cfg.queued,
+	}
+	st.running.Store(1)
+
+	obs := cfg.observer
+	if obs == nil {
+		obs = p.obs
+	}
+	if obs != nil {
+		st.obs = &stageObserver{obs: obs, info: st.info, clock: cfg.clock}
+	}
+
+	p.mu.Lock()
+	p.stages = append(p.stages, st)
+	p.mu.Unlock()
+
+	if p.log != nil {
+		p.log.Debug("stage started", st.attrs()...)
+	}
+	return st, context.WithValue(ctx, stageKey{}, st)
+}
+
+// registered returns a snapshot of the stages of the pipeline.
+func (p *Pipeline) registered() []*stage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*stage(nil), p.stages...)
+}
+
+// stageFrom returns the stage ctx belongs to, if any.
+func stageFrom(ctx context.Context) *stage {
+	st, _ := ctx.Value(stageKey{}).(*stage)
+	return st
+}
+
+// launched marks the end of the construction of the stage.
+func (s *stage) launched() {
+	s.exit(nil, nil)
+}
+
+// setParallel makes fn report the current number of workers of the stage.
+func (s *stage) setParallel(fn func() int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.parallel = fn
+}
+
+// receive accounts for an element read from the input.
+func (s *stage) receive() {
+	s.received.Add(1)
+	s.obs.receive()
+}
+
+// emit accounts for an element sent downstream; queued is the length of the
+// output channel after the send.
+func (s *stage) emit(queued int) {
+	if s.queued != nil {
+		queued = s.queued()
+	}
+	s.emitted.Add(1)
+	s.obs.emit(queued)
+}
+
+// enter accounts for a new goroutine of the stage.
+func (s *stage) enter() {
+	if s != nil {
+		s.running.Add(1)
+	}
+}
+
+// exit accounts for the end of a goroutine of the stage that failed with
+// err, logging the stop of the stage with its last one.
+func (s *stage) exit(ctx context.Context, err error) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	err = s.err
+	s.mu.Unlock()
+
+	if s.running.Add(-1) > 0 || s.p.log == nil {
+		return
+	}
+
+	attrs := s.attrs()
+	if err != nil {
+		attrs = append(attrs, slog.Any("err", err))
+		if ctx != nil && errors.Is(err, context.Canceled) {
+			attrs = append(attrs, slog.Any("cause", context.Cause(ctx)))
+		}
+	}
+	s.p.log.Debug("stage stopped", attrs...)
+}
+
+func (s *stage) attrs() []any {
+	return []any{
+		slog.String("pipeline", s.info.Pipeline),
+		slog.String("stage", s.info.Name),
+		slog.String("kind", s.info.Kind),
+	}
+}
+
+// probe tracks what a goroutine of a stage is doing, see Pipeline.Diagnose.
+type probe struct {
+	st    *stage
+	clock Clock        // of the pipeline, nil unless diagnostics are enabled
+	state atomic.Int32 // StageState
+	since atomic.Int64 // unix nanoseconds of the last state change
+}
+
+// probe registers a new goroutine of the stage, initially reading its input.
+// It must be stopped when the goroutine returns. Without diagnostics (see
+// WithDiagnostics), the probe only accounts for received elements.
+func (s *stage) probe() *probe {
+	pr := &probe{st: s}
+	if !s.p.diagnostics {
+		return pr
+	}
+	pr.clock = s.p.clock
+	pr.set(StageReading)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.probes == nil {
+		s.probes = make(map[*probe]struct{})
+	}
+	s.probes[pr] = struct{}{}
+	return pr
+}
+
+func (pr *probe) set(state StageState) {
+	if pr.clock == nil {
+		return
+	}
+	pr.since.Store(pr.clock.Now().UnixNano())
+	pr.state.Store(int32(state))
+}
+
+func (pr *probe) stop() {
+	if pr.clock == nil {
+		return
+	}
+	pr.st.mu.Lock()
+	defer pr.st.mu.Unlock()
+	delete(pr.st.probes, pr)
+}
+
+// receive accounts for an element read from the input, which the goroutine
+// now processes.
+func (pr *probe) receive() {
+	pr.st.receive()
+	pr.set(StageRunning)
+}
@@ -0,0 +1,195 @@
+package chankit
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tracer starts spans around the calls of the functions of Map and Filter
+// stages. It is attached to a stage with WithTracer, or to every stage of a
+// pipeline with WithPipelineTracer.
+type Tracer interface {
+	// StartSpan starts a span for a call of the function of stage s. The
+	// parent span, if any, is carried by ctx (see SpanContextFromContext);
+	// the returned context must carry the new one.
+	StartSpan(ctx context.Context, s StageInfo) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// End ends the span of a call that returned err.
+	End(err error)
+}
+
+// SpanContext identifies a span within a trace. The zero value is no span.
+type SpanContext struct {
+	TraceID uint64
+	SpanID  uint64
+}
+
+// IsValid reports whether sc identifies a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != 0
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying sc.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx, if any.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// Traced is an element envelope carrying the span context of the stage call
+// that produced it, so that spans of consecutive stages link together.
+//
+// Stages reading Traced elements start their spans as children of Span.
+// TracedFunc and TracedPred adapt functions to work on envelopes.
+type Traced[A any] struct {
+	Val  A
+	Span SpanContext
+}
+
+func (t Traced[A]) traceParent() SpanContext {
+	return t.Span
+}
+
+// TracedFunc adapts fn to Traced elements for MapErrCtx: the output
+// envelope carries the span of the call that produced it. In a stage without
+// a tracer, it carries the span of the input envelope instead.
+func TracedFunc[A, B any](
+	fn func(context.Context, A) (B, error),
+) func(context.Context, Traced[A]) (Traced[B], error) {
+	return func(ctx context.Context, t Traced[A]) (Traced[B], error) {
+		b, err := fn(ctx, t.Val)
+		sc := SpanContextFromContext(ctx)
+		if !sc.IsValid() {
+			sc = t.Span
+		}
+		return Traced[B]{Val: b, Span: sc}, err
+	}
+}
+
+// TracedPred adapts pred to Traced elements for FilterErrCtx. Forwarded
+// envelopes are unchanged, so downstream spans are siblings of the filter
+// span rather than its children.
+func TracedPred[A any](
+	pred func(context.Context, A) (bool, error),
+) func(context.Context, Traced[A]) (bool, error) {
+	return func(ctx context.Context, t Traced[A]) (bool, error) {
+		return pred(ctx, t.Val)
+	}
+}
+
+// tracedFunc runs every call of fn in a span of stage s. Calls on Traced
+// elements are children of the span of the element.
+func tracedFunc[A, B any](
+	tracer Tracer,
+	s StageInfo,
+	fn func(context.Context, A) (B, error),
+) func(context.Context, A) (B, error) {
+	if tracer == nil {
+		return fn
+	}
+	return func(ctx context.Context, a A) (B, error) {
+		if t, ok := any(a).(interface{ traceParent() SpanContext }); ok {
+			if sc := t.traceParent(); sc.IsValid() {
+				ctx = ContextWithSpanContext(ctx, sc)
+			}
+		}
+
+		ctx, span := tracer.StartSpan(ctx, s)
+		b, err := fn(ctx, a)
+		span.End(err)
+		return b, err
+	}
+}
+
+// stageTracer returns the tracer of a stage, if any.
+func (p *Pipeline) stageTracer(cfg *config) Tracer {
+	if cfg.tracer != nil {
+		return cfg.tracer
+	}
+	return p.tracer
+}
+
+type noopTracer struct{}
+
+func (noopTracer) StartSpan(ctx context.Context, _ StageInfo) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) End(error) {}
+
+// NoopTracer returns a Tracer that records nothing, e.g. to disable the
+// tracer of a pipeline for a single stage.
+func NoopTracer() Tracer {
+	return noopTracer{}
+}
+
+// RecordedSpan is a span recorded by a RecordingTracer.
+type RecordedSpan struct {
+	Stage   StageInfo
+	Context SpanContext
+	Parent  SpanContext // zero for root spans
+	Start   time.Time
+	End     time.Time
+	Err     error
+}
+
+// RecordingTracer is a Tracer keeping ended spans in memory, e.g. for tests.
+type RecordingTracer struct {
+	ids atomic.Uint64
+
+	mu    sync.Mutex
+	spans []RecordedSpan
+}
+
+// NewRecordingTracer returns an empty RecordingTracer.
+func NewRecordingTracer() *RecordingTracer {
+	return &RecordingTracer{}
+}
+
+func (t *RecordingTracer) StartSpan(ctx context.Context, s StageInfo) (context.Context, Span) {
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{TraceID: parent.TraceID, SpanID: t.ids.Add(1)}
+	if !parent.IsValid() {
+		sc.TraceID = sc.SpanID
+	}
+
+	span := &recordingSpan{
+		tracer: t,
+		rec:    RecordedSpan{Stage: s, Context: sc, Parent: parent, Start: time.Now()},
+	}
+	return ContextWithSpanContext(ctx, sc), span
+}
+
+// Spans returns the ended spans in the order they ended.
+func (t *RecordingTracer) Spans() []RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]RecordedSpan(nil), t.spans...)
+}
+
+type recordingSpan struct {
+	tracer *RecordingTracer
+	rec    RecordedSpan
+}
+
+func (s *recordingSpan) End(err error) {
+	s.rec.End = time.Now()
+	s.rec.Err = err
+
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, s.rec)
+}
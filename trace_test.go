@@ -0,0 +1,111 @@
+package chankit
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestTracer(t *testing.T) {
+	t.Run("linked spans", func(t *testing.T) {
+		t.Parallel()
+
+		tracer := NewRecordingTracer()
+		p, ctx := NewPipeline(t.Context(), WithPipelineTracer(tracer))
+
+		in := make(chan Traced[int], 5)
+		for _, x := range genInts(5) {
+			in <- Traced[int]{Val: x}
+		}
+		close(in)
+
+		inc := func(_ context.Context, x int) (int, error) { return x + 1, nil }
+		even := func(_ context.Context, x int) (bool, error) { return x%2 == 0, nil }
+
+		parsed := MapErrCtx(ctx, p, in, TracedFunc(inc), WithName("parse"), WithParallel(2))
+		kept := FilterErrCtx(ctx, p, parsed, TracedPred(even), WithName("keep"))
+		got := chan2slice(MapErrCtx(ctx, p, kept, TracedFunc(inc), WithName("enrich")))
+		assertNoPipeError(t, p)
+
+		spans := make(map[SpanContext]RecordedSpan)
+		for _, s := range tracer.Spans() {
+			spans[s.Context] = s
+		}
+		if len(spans) != 5+5+2 {
+			t.Fatalf("expected 12 spans, got %d", len(spans))
+		}
+
+		parents := map[string]string{"parse": "", "keep": "parse", "enrich": "parse"}
+		for _, s := range spans {
+			want := parents[s.Stage.Name]
+			parent, ok := spans[s.Parent]
+			switch {
+			case want == "" && s.Parent.IsValid():
+				t.Fatalf("expected root span, got %+v", s)
+			case want != "" && (!ok || parent.Stage.Name != want):
+				t.Fatalf("expected %s span to be a child of %s, got %+v", s.Stage.Name, want, s)
+			case s.Context.TraceID != parent.Context.TraceID && ok:
+				t.Fatalf("expected span to share the trace of its parent, got %+v", s)
+			}
+		}
+
+		for _, out := range got {
+			if spans[out.Span].Stage.Name != "enrich" {
+				t.Fatalf("expected output to carry the enrich span, got %+v", out)
+			}
+		}
+	})
+
+	t.Run("untraced stage", func(t *testing.T) {
+		t.Parallel()
+
+		tracer := NewRecordingTracer()
+		p, ctx := NewPipeline(t.Context())
+
+		inc := func(_ context.Context, x int) (int, error) { return x + 1, nil }
+
+		a := MapErrCtx(ctx, p, slice2chan([]Traced[int]{{Val: 1}}), TracedFunc(inc),
+			WithName("a"), WithTracer(tracer))
+		b := MapErrCtx(ctx, p, a, TracedFunc(inc), WithName("b"))
+		got := chan2slice(MapErrCtx(ctx, p, b, TracedFunc(inc), WithName("c"), WithTracer(tracer)))
+		assertNoPipeError(t, p)
+
+		spans := make(map[string]RecordedSpan)
+		for _, s := range tracer.Spans() {
+			spans[s.Stage.Name] = s
+		}
+		if len(spans) != 2 {
+			t.Fatalf("expected spans of a and c, got %+v", spans)
+		}
+		if spans["c"].Parent != spans["a"].Context {
+			t.Fatalf("expected c span to be a child of a, got %+v", spans)
+		}
+		if len(got) != 1 || got[0].Span != spans["c"].Context {
+			t.Fatalf("expected output to carry the c span, got %+v", got)
+		}
+	})
+
+	t.Run("stage tracer", func(t *testing.T) {
+		t.Parallel()
+
+		errBoom := errors.New("boom")
+		tracer := NewRecordingTracer()
+		p, ctx := NewPipeline(t.Context(), WithPipelineTracer(NoopTracer()))
+
+		for range FilterErr(ctx, p, slice2chan(genInts(3)), func(x int) (bool, error) {
+			if x == 1 {
+				return false, errBoom
+			}
+			return true, nil
+		}, WithTracer(tracer)) {
+		}
+		if err := p.Wait(); !errors.Is(err, errBoom) {
+			t.Fatalf("expected %v, got %v", errBoom, err)
+		}
+
+		spans := tracer.Spans()
+		if len(spans) != 2 || spans[0].Err != nil || !errors.Is(spans[1].Err, errBoom) {
+			t.Fatalf("unexpected spans %+v", spans)
+		}
+	})
+}
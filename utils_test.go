@@ -3,7 +3,9 @@ package chankit
 import (
 	"cmp"
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 )
 
 func genInts(n int) []int {
@@ -119,3 +121,150 @@ func previewSlice[T any](s []T, n int) string {
 	}
 	return fmt.Sprintf("%v ...(showing %d/%d)", s[:n], n, len(s))
 }
+
+// fakeClock is a Clock whose time only moves on Advance.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	return c.newTimer(d, 0)
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	return fakeTicker{c.newTimer(d, d)}
+}
+
+func (c *fakeClock) newTimer(d, period time.Duration) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, ch: make(chan time.Time, 1), period: period}
+	c.timers = append(c.timers, t)
+	t.resetLocked(d)
+	return t
+}
+
+// Advance moves the clock forward by d, firing due timers and tickers.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		t.fireLocked()
+	}
+}
+
+type fakeTimer struct {
+	clock  *fakeClock
+	ch     chan time.Time
+	at     time.Time
+	period time.Duration
+	active bool
+}
+
+type fakeTicker struct{ *fakeTimer }
+
+func (t fakeTicker) Stop() { t.fakeTimer.Stop() }
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := t.active
+	t.active = false
+	t.drainLocked()
+	return wasActive
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := t.active
+	t.drainLocked()
+	t.resetLocked(d)
+	return wasActive
+}
+
+func (t *fakeTimer) resetLocked(d time.Duration) {
+	t.at = t.clock.now.Add(d)
+	t.active = true
+	t.fireLocked()
+}
+
+func (t *fakeTimer) fireLocked() {
+	if !t.active || t.at.After(t.clock.now) {
+		return
+	}
+	select {
+	case t.ch <- t.clock.now:
+	default:
+	}
+	if t.period <= 0 {
+		t.active = false
+		return
+	}
+	for !t.at.After(t.clock.now) {
+		t.at = t.at.Add(t.period)
+	}
+}
+
+func (t *fakeTimer) drainLocked() {
+	select {
+	case <-t.ch:
+	default:
+	}
+}
+
+// recvAdvancing receives from ch, advancing clock by step until a value (or
+// the close of ch) is available. Real time only bounds the wait.
+func recvAdvancing[T any](
+	t *testing.T,
+	clock *fakeClock,
+	step time.Duration,
+	ch <-chan T,
+) (T, bool) {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case v, ok := <-ch:
+			return v, ok
+		case <-time.After(time.Millisecond):
+			clock.Advance(step)
+		case <-deadline:
+			t.Fatal("timed out")
+		}
+	}
+}
+
+// collectAdvancing is like chan2slice, advancing clock by step while ch is
+// not ready.
+func collectAdvancing[T any](
+	t *testing.T,
+	clock *fakeClock,
+	step time.Duration,
+	ch <-chan T,
+) []T {
+	t.Helper()
+	var res []T
+	for {
+		v, ok := recvAdvancing(t, clock, step, ch)
+		if !ok {
+			return res
+		}
+		res = append(res, v)
+	}
+}
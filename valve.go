@@ -0,0 +1,113 @@
+package chankit
+
+import (
+	"context"
+	"sync"
+)
+
+// ValveControl opens and closes Valve stages. A control may drive several
+// stages, e.g. one Valve behind every source to pause a whole pipeline.
+// The zero value is an open valve.
+type ValveControl struct {
+	mu     sync.Mutex
+	paused bool
+	change chan struct{} // closed on the next Pause or Resume
+}
+
+// Pause makes the controlled stages stop pulling elements from their input.
+func (c *ValveControl) Pause() {
+	c.set(true)
+}
+
+// Resume makes the controlled stages pull elements again.
+func (c *ValveControl) Resume() {
+	c.set(false)
+}
+
+// Paused reports whether the valve is closed.
+func (c *ValveControl) Paused() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.paused
+}
+
+func (c *ValveControl) set(paused bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paused == paused {
+		return
+	}
+	c.paused = paused
+	if c.change != nil {
+		close(c.change)
+		c.change = nil
+	}
+}
+
+// state returns whether the valve is closed and a channel closed on the
+// next change.
+func (c *ValveControl) state() (bool, <-chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.change == nil {
+		c.change = make(chan struct{})
+	}
+	return c.paused, c.change
+}
+
+// Valve forwards elements from `in` while `ctrl` is open.
+//
+// While ctrl is paused, it stops pulling from `in`: upstream stages block
+// once their buffers are full and keep their state, e.g. Fold accumulators
+// or Map reorder buffers, while downstream stages drain what they already
+// hold. Nothing is lost or reordered across a pause.
+// It closes the returned channel after input is fully consumed.
+// If ctx is canceled, it stops early and returns, paused or not.
+func Valve[A any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	ctrl *ValveControl,
+	opts ...Option,
+) <-chan A {
+	cfg := makeConfig(opts)
+	out, ret := makeOut[A](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "valve", ret, in)
+	defer st.launched()
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		for {
+			paused, change := ctrl.state()
+			inC := in
+			if paused {
+				inC = nil
+			}
+
+			pr.set(StageReading)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-change:
+			case a, ok := <-inC:
+				if !ok {
+					return nil
+				}
+				st.receive()
+
+				pr.set(StageSending)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case out <- a:
+					st.emit(len(out))
+				}
+			}
+		}
+	})
+
+	return ret
+}
@@ -0,0 +1,61 @@
+package chankit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestValve(t *testing.T) {
+	t.Run("pause and resume", func(t *testing.T) {
+		t.Parallel()
+
+		in := make(chan int)
+		var ctrl ValveControl
+
+		p, ctx := NewPipeline(t.Context())
+		out := Fold(ctx, p, Valve(ctx, p, in, &ctrl), 0, func(acc, x int) int { return acc + x })
+
+		in <- 1
+		in <- 2
+
+		ctrl.Pause()
+		if !ctrl.Paused() {
+			t.Fatal("expected valve to be paused")
+		}
+		select {
+		case in <- 3:
+			t.Fatal("paused valve must not pull elements")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		ctrl.Resume()
+		in <- 3
+		close(in)
+
+		if got := <-out; got != 6 {
+			t.Fatalf("expected accumulator 6, got %d", got)
+		}
+		assertNoPipeError(t, p)
+	})
+
+	t.Run("cancel while paused", func(t *testing.T) {
+		t.Parallel()
+
+		var ctrl ValveControl
+		ctrl.Pause()
+
+		ctx, cancel := context.WithCancel(t.Context())
+		p, ctx := NewPipeline(ctx)
+		out := Valve(ctx, p, slice2chan(genInts(10)), &ctrl)
+
+		cancel()
+		for range out {
+			t.Fatal("paused valve must not emit")
+		}
+		if err := p.Wait(); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+	})
+}
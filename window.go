@@ -0,0 +1,246 @@
+package chankit
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+type windowKind int
+
+const (
+	windowTumbling windowKind = iota
+	windowSliding
+	windowSession
+)
+
+// WindowSpec describes how elements are grouped into windows.
+// Use TumblingWindow, SlidingWindow or SessionWindow to create one.
+type WindowSpec struct {
+	kind  windowKind
+	size  time.Duration
+	slide time.Duration
+	gap   time.Duration
+}
+
+// TumblingWindow groups elements into fixed-size, non-overlapping windows
+// aligned to multiples of size.
+func TumblingWindow(size time.Duration) WindowSpec {
+	if size <= 0 {
+		panic("TumblingWindow: size must be > 0")
+	}
+	return WindowSpec{kind: windowTumbling, size: size, slide: size}
+}
+
+// SlidingWindow groups elements into fixed-size windows starting every
+// slide. An element belongs to every window covering its time.
+func SlidingWindow(size, slide time.Duration) WindowSpec {
+	if size <= 0 || slide <= 0 {
+		panic("SlidingWindow: size and slide must be > 0")
+	}
+	return WindowSpec{kind: windowSliding, size: size, slide: slide}
+}
+
+// SessionWindow groups elements into windows separated by at least gap of
+// silence. A session ends gap after its last element.
+func SessionWindow(gap time.Duration) WindowSpec {
+	if gap <= 0 {
+		panic("SessionWindow: gap must be > 0")
+	}
+	return WindowSpec{kind: windowSession, gap: gap}
+}
+
+// starts returns the starts of the fixed-size windows covering t in
+// ascending order. It must not be called for session windows.
+func (s WindowSpec) starts(t time.Time) []time.Time {
+	last := t.Truncate(s.slide)
+	var starts []time.Time
+	for start := last; start.Add(s.size).After(t); start = start.Add(-s.slide) {
+		starts = append(starts, start)
+	}
+	slices.Reverse(starts)
+	return starts
+}
+
+// Window is a group of elements received in [Start, End).
+type Window[A any] struct {
+	Start time.Time
+	End   time.Time
+	Items []A
+}
+
+// WindowAgg is the accumulator of elements received in [Start, End).
+type WindowAgg[B any] struct {
+	Start time.Time
+	End   time.Time
+	Acc   B
+}
+
+// Windows groups elements from `in` into windows by processing time.
+//
+// Each element is stamped with the clock time (see WithClock) at which it is
+// received. A window is emitted once the clock passes its end; windows
+// without elements are not emitted. When the input closes, the windows that
+// are still open are emitted and the returned channel is closed.
+// If ctx is canceled, it stops early and returns.
+func Windows[A any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	spec WindowSpec,
+	opts ...Option,
+) <-chan Window[A] {
+	return foldWindows(
+		ctx,
+		p,
+		in,
+		spec,
+		nil,
+		func(items []A, a A) []A { return append(items, a) },
+		func(w WindowAgg[[]A]) Window[A] {
+			return Window[A]{Start: w.Start, End: w.End, Items: w.Acc}
+		},
+		opts...)
+}
+
+// FoldWindows is like Windows, but reduces the elements of each window into
+// an accumulator using `f` instead of retaining them.
+//
+// Every window starts from `init`.
+func FoldWindows[A, B any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	spec WindowSpec,
+	init B,
+	f func(B, A) B,
+	opts ...Option,
+) <-chan WindowAgg[B] {
+	identity := func(w WindowAgg[B]) WindowAgg[B] { return w }
+	return foldWindows(ctx, p, in, spec, init, f, identity, opts...)
+}
+
+// foldWindows implements FoldWindows, converting every emitted window with
+// `conv`.
+func foldWindows[A, B, C any](
+	ctx context.Context,
+	p *Pipeline,
+	in <-chan A,
+	spec WindowSpec,
+	init B,
+	f func(B, A) B,
+	conv func(WindowAgg[B]) C,
+	opts ...Option,
+) <-chan C {
+	cfg := makeConfig(opts)
+	out, ret := makeOut[C](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "windows", ret, in)
+	defer st.launched()
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		clock := cfg.clock
+		// ordered by end, which for every window kind is also start order
+		var open []*WindowAgg[B]
+
+		var timer Timer
+		var timerC <-chan time.Time
+		var armedAt time.Time
+		arm := func() {
+			if len(open) == 0 || (open[0].End.Equal(armedAt) && timerC != nil) {
+				return
+			}
+			armedAt = open[0].End
+			d := armedAt.Sub(clock.Now())
+			if timer == nil {
+				timer = clock.NewTimer(d)
+			} else {
+				timer.Stop()
+				timer.Reset(d)
+			}
+			timerC = timer.C()
+		}
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+
+		emit := func(w *WindowAgg[B]) error {
+			pr.set(StageSending)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case out <- conv(*w):
+				st.emit(len(out))
+				return nil
+			}
+		}
+
+		flush := func(now time.Time) error {
+			for len(open) > 0 && !open[0].End.After(now) {
+				if err := emit(open[0]); err != nil {
+					return err
+				}
+				open = open[1:]
+			}
+			return nil
+		}
+
+		for {
+			pr.set(StageReading)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-timerC:
+				timerC = nil
+				if err := flush(clock.Now()); err != nil {
+					return err
+				}
+				arm()
+			case a, ok := <-in:
+				if !ok {
+					for _, w := range open {
+						if err := emit(w); err != nil {
+							return err
+						}
+					}
+					return nil
+				}
+				pr.receive()
+
+				now := clock.Now()
+				if err := flush(now); err != nil {
+					return err
+				}
+
+				if spec.kind == windowSession {
+					if len(open) == 0 {
+						open = append(open, &WindowAgg[B]{Start: now, Acc: init})
+					}
+					open[0].End = now.Add(spec.gap)
+					open[0].Acc = f(open[0].Acc, a)
+				} else {
+					for _, start := range spec.starts(now) {
+						i, found := slices.BinarySearchFunc(
+							open,
+							start,
+							func(w *WindowAgg[B], t time.Time) int { return w.Start.Compare(t) },
+						)
+						if !found {
+							w := &WindowAgg[B]{Start: start, End: start.Add(spec.size), Acc: init}
+							open = slices.Insert(open, i, w)
+						}
+						open[i].Acc = f(open[i].Acc, a)
+					}
+				}
+				arm()
+			}
+		}
+	})
+
+	return ret
+}
@@ -0,0 +1,163 @@
+package chankit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindowSpecStarts(t *testing.T) {
+	base := time.Unix(0, 0)
+	at := func(sec int) time.Time { return base.Add(time.Duration(sec) * time.Second) }
+
+	tests := []struct {
+		name string
+		spec WindowSpec
+		t    time.Time
+		want []time.Time
+	}{
+		{"tumbling", TumblingWindow(10 * time.Second), at(12), []time.Time{at(10)}},
+		{"tumbling boundary", TumblingWindow(10 * time.Second), at(10), []time.Time{at(10)}},
+		{
+			"sliding",
+			SlidingWindow(10*time.Second, 5*time.Second),
+			at(12),
+			[]time.Time{at(5), at(10)},
+		},
+		{
+			"sliding boundary",
+			SlidingWindow(10*time.Second, 5*time.Second),
+			at(15),
+			[]time.Time{at(10), at(15)},
+		},
+		{
+			"sliding with gaps",
+			SlidingWindow(5*time.Second, 10*time.Second),
+			at(17),
+			nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.spec.starts(tc.t)
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+			for i := range got {
+				if !got[i].Equal(tc.want[i]) {
+					t.Fatalf("expected %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestWindows(t *testing.T) {
+	t.Run("tumbling", func(t *testing.T) {
+		t.Parallel()
+
+		size := time.Hour
+		p, ctx := NewPipeline(t.Context())
+		out := Windows(ctx, p, slice2chan([]int{1, 2, 3}), TumblingWindow(size))
+
+		var items []int
+		for w := range out {
+			if w.End.Sub(w.Start) != size {
+				t.Fatalf("unexpected window bounds %v - %v", w.Start, w.End)
+			}
+			items = append(items, w.Items...)
+		}
+
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, []int{1, 2, 3}, items)
+	})
+
+	t.Run("emits on window end", func(t *testing.T) {
+		t.Parallel()
+
+		clock := newFakeClock()
+		in := make(chan int)
+		p, ctx := NewPipeline(t.Context())
+		out := Windows(ctx, p, in, TumblingWindow(10*time.Second), WithClock(clock))
+
+		in <- 1
+
+		w, _ := recvAdvancing(t, clock, time.Second, out)
+		assertSlicesEqual(t, []int{1}, w.Items)
+
+		close(in)
+		for range out {
+		}
+		assertNoPipeError(t, p)
+	})
+
+	t.Run("session", func(t *testing.T) {
+		t.Parallel()
+
+		clock := newFakeClock()
+		gap := 20 * time.Second
+		in := make(chan int)
+		p, ctx := NewPipeline(t.Context())
+		out := Windows(ctx, p, in, SessionWindow(gap), WithClock(clock))
+
+		in <- 1
+		in <- 2
+
+		// a step shorter than gap cannot split the first session
+		first, _ := recvAdvancing(t, clock, gap/4, out)
+		in <- 3
+		close(in)
+
+		got := append([]Window[int]{first}, chan2slice(out)...)
+		assertNoPipeError(t, p)
+
+		if len(got) != 2 {
+			t.Fatalf("expected 2 sessions, got %v", got)
+		}
+		assertSlicesEqual(t, []int{1, 2}, got[0].Items)
+		assertSlicesEqual(t, []int{3}, got[1].Items)
+		if got[0].End.After(got[1].Start) {
+			t.Fatalf("sessions overlap: %v, %v", got[0], got[1])
+		}
+	})
+
+	t.Run("options", func(t *testing.T) {
+		t.Parallel()
+
+		p, ctx := NewPipeline(t.Context())
+		out := Windows(ctx, p, slice2chan([]int{1, 2}), TumblingWindow(time.Hour), WithBuffer(4))
+
+		if c := cap(out); c != 4 {
+			t.Fatalf("expected output buffer of 4, got %d", c)
+		}
+		for range out {
+		}
+		assertNoPipeError(t, p)
+	})
+}
+
+func TestFoldWindows(t *testing.T) {
+	t.Parallel()
+
+	p, ctx := NewPipeline(t.Context())
+	out := FoldWindows(
+		ctx,
+		p,
+		slice2chan(genInts(100)),
+		SlidingWindow(time.Hour, time.Minute),
+		0,
+		func(cnt, _ int) int { return cnt + 1 },
+	)
+
+	got := chan2slice(out)
+	assertNoPipeError(t, p)
+
+	// every element belongs to 60 sliding windows
+	total := 0
+	for _, w := range got {
+		total += w.Acc
+	}
+	if total != 100*60 {
+		t.Fatalf("expected %d element assignments, got %d", 100*60, total)
+	}
+}
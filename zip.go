@@ -0,0 +1,131 @@
+package chankit
+
+import "context"
+
+// Pair holds one element from each side of a Zip.
+type Pair[A, B any] struct {
+	Left  A
+	Right B
+}
+
+// Zip pairs elements from `leftIn` and `rightIn` in lock-step.
+//
+// See ZipWith for the halting and padding rules.
+func Zip[A, B any](
+	ctx context.Context,
+	p *Pipeline,
+	leftIn <-chan A,
+	rightIn <-chan B,
+	opts ...Option,
+) <-chan Pair[A, B] {
+	return ZipWith(
+		ctx,
+		p,
+		leftIn,
+		rightIn,
+		func(a A, b B) Pair[A, B] { return Pair[A, B]{Left: a, Right: b} },
+		opts...)
+}
+
+// ZipWith combines elements from `leftIn` and `rightIn` in lock-step
+// using `f`: the nth output is built from the nth element of each side.
+//
+// The HaltStrategy (see WithHaltStrategy) decides what happens when a side
+// finishes. Once the strategy halts, any unpaired element is discarded and
+// the returned channel is closed. Until then, elements of the remaining side
+// are paired with the zero value of the finished side, or, with
+// WithStrictLength, the pipeline fails with ErrLengthMismatch.
+// With the default HaltBoth, the shorter side is padded.
+// If ctx is canceled, it stops early and returns.
+func ZipWith[A, B, C any](
+	ctx context.Context,
+	p *Pipeline,
+	leftIn <-chan A,
+	rightIn <-chan B,
+	f func(A, B) C,
+	opts ...Option,
+) <-chan C {
+	if leftIn == nil || rightIn == nil {
+		panic("ZipWith: input channels must not be nil")
+	}
+
+	cfg := makeConfig(opts)
+	out, ret := makeOut[C](ctx, p, cfg)
+	st, ctx := p.newStage(ctx, cfg, "zip", ret, leftIn, rightIn)
+	defer st.launched()
+
+	p.goSafe(ctx, func() error {
+		defer close(out)
+		pr := st.probe()
+		defer pr.stop()
+
+		var leftDone, rightDone bool
+		var haveLeft, haveRight bool
+		var left A
+		var right B
+
+		for {
+			stop, err := cfg.haltStrategy.halted(leftDone, rightDone)
+			if err != nil {
+				return err
+			}
+			if stop {
+				return nil
+			}
+
+			if (leftDone && haveRight) || (rightDone && haveLeft) {
+				if cfg.strictLength {
+					return ErrLengthMismatch
+				}
+				haveLeft, haveRight = true, true
+			}
+
+			if haveLeft && haveRight {
+				pr.set(StageSending)
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case out <- f(left, right):
+					st.emit(len(out))
+				}
+				var zeroA A
+				var zeroB B
+				left, right = zeroA, zeroB
+				haveLeft, haveRight = false, false
+				continue
+			}
+
+			lc, rc := leftIn, rightIn
+			if haveLeft {
+				lc = nil
+			}
+			if haveRight {
+				rc = nil
+			}
+
+			pr.set(StageReading)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case la, ok := <-lc:
+				if !ok {
+					leftDone = true
+					leftIn = nil
+					continue
+				}
+				st.receive()
+				left, haveLeft = la, true
+			case rb, ok := <-rc:
+				if !ok {
+					rightDone = true
+					rightIn = nil
+					continue
+				}
+				st.receive()
+				right, haveRight = rb, true
+			}
+		}
+	})
+
+	return ret
+}
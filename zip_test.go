@@ -0,0 +1,129 @@
+package chankit
+
+import (
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestZip(t *testing.T) {
+	tests := []struct {
+		name  string
+		halt  HaltStrategy
+		left  []int
+		right []string
+		want  []Pair[int, string]
+	}{
+		{
+			"equal length",
+			HaltBoth,
+			[]int{1, 2},
+			[]string{"a", "b"},
+			[]Pair[int, string]{{1, "a"}, {2, "b"}},
+		},
+		{
+			"halt-both pads right",
+			HaltBoth,
+			[]int{1, 2, 3},
+			[]string{"a"},
+			[]Pair[int, string]{{1, "a"}, {2, ""}, {3, ""}},
+		},
+		{
+			"halt-both pads left",
+			HaltBoth,
+			[]int{1},
+			[]string{"a", "b"},
+			[]Pair[int, string]{{1, "a"}, {0, "b"}},
+		},
+		{
+			"halt-either",
+			HaltEither,
+			[]int{1, 2, 3},
+			[]string{"a"},
+			[]Pair[int, string]{{1, "a"}},
+		},
+		{
+			"halt-left shorter",
+			HaltLeft,
+			[]int{1},
+			[]string{"a", "b"},
+			[]Pair[int, string]{{1, "a"}},
+		},
+		{
+			"halt-left longer",
+			HaltLeft,
+			[]int{1, 2},
+			[]string{"a"},
+			[]Pair[int, string]{{1, "a"}, {2, ""}},
+		},
+		{
+			"halt-right",
+			HaltRight,
+			[]int{1, 2, 3},
+			[]string{"a", "b"},
+			[]Pair[int, string]{{1, "a"}, {2, "b"}},
+		},
+		{"empty", HaltBoth, nil, nil, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			p, ctx := NewPipeline(t.Context())
+			out := Zip(
+				ctx,
+				p,
+				slice2chan(tc.left),
+				slice2chan(tc.right),
+				WithHaltStrategy(tc.halt),
+			)
+			got := chan2slice(out)
+
+			assertNoPipeError(t, p)
+			if !slices.Equal(tc.want, got) {
+				t.Fatalf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestZipWith(t *testing.T) {
+	t.Run("combine", func(t *testing.T) {
+		t.Parallel()
+
+		p, ctx := NewPipeline(t.Context())
+		out := ZipWith(
+			ctx,
+			p,
+			slice2chan([]int{1, 2, 3}),
+			slice2chan([]string{"a", "b", "c"}),
+			func(i int, s string) string { return s + strconv.Itoa(i) },
+		)
+		got := chan2slice(out)
+
+		assertNoPipeError(t, p)
+		assertSlicesEqual(t, []string{"a1", "b2", "c3"}, got)
+	})
+
+	t.Run("strict length", func(t *testing.T) {
+		t.Parallel()
+
+		p, ctx := NewPipeline(t.Context())
+		out := ZipWith(
+			ctx,
+			p,
+			slice2chan([]int{1, 2, 3}),
+			slice2chan([]int{1}),
+			func(a, b int) int { return a + b },
+			WithStrictLength(),
+		)
+		got := chan2slice(out)
+
+		if err := p.Wait(); !errors.Is(err, ErrLengthMismatch) {
+			t.Fatalf("expected %v, got %v", ErrLengthMismatch, err)
+		}
+		assertSlicesEqual(t, []int{2}, got)
+	})
+}